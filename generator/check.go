@@ -0,0 +1,157 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a unified diff
+const diffContext = 3
+
+// Compare reads the file from disk and returns a unified diff from it to the generated content, which is empty if the
+// file is up to date.  A missing file is compared as if it were empty.
+func (f GeneratedFile) Compare() (string, error) {
+	existing, err := os.ReadFile(f.Name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	return unifiedDiff(f.Name, string(existing), string(f.Content)), nil
+}
+
+// edit is a line that is kept (' '), removed ('-') or added ('+') by a diff
+type edit struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns the changes from a to b in the unified format used by "diff -u", or "" if they are the same
+func unifiedDiff(name string, a, b string) string {
+	if a == b {
+		return ""
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s (generated)\n", name, name)
+	aLine, bLine := 0, 0 // number of lines of a and b before edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			aLine, bLine = aLine+1, bLine+1
+			i++
+			continue
+		}
+		// a hunk starts with the context before the first change and continues while changes are close together
+		start := max(0, i-diffContext)
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		end := i
+		for j := i; j < len(edits) && j < end+2*diffContext+1; j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+			}
+		}
+		end = min(len(edits), end+diffContext)
+
+		var aCount, bCount int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		aLine, bLine = aStart+aCount, bStart+bCount
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the lines of a hunk given the number of lines before it, which is the line number used for an
+// empty range
+func hunkRange(before int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines splits text into lines that keep their newlines
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest list of edits turning a into b, found with Myers' algorithm
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1) // furthest x reached on each diagonal k = x - y, indexed by k + offset
+	// the diagonals -d-1 to d+1 of v before each step d
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// walk back through the furthest points of each step to recover the edits in reverse order
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[k-1+d+1] < v[k+1+d+1]) {
+			prevK = k + 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{'+', b[y-1]})
+			} else {
+				edits = append(edits, edit{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	slices.Reverse(edits)
+	return edits
+}
@@ -0,0 +1,325 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatDefault converts default values into Go expressions.  Strings are quoted unless quoting is disabled, and values
+// for well-known types such as durations, times, URLs and IP addresses may be written in their usual text form.
+// Values with the "expr" flag are always used as Go expressions, such as the name of a constant or a function call.
+func formatDefault(resolver structResolver, fieldType ast.Expr, defaultValue string, flags map[string]string) (string, error) {
+	if defaultValue == "" {
+		return defaultValue, nil
+	}
+	if _, ok := flags["expr"]; ok {
+		return defaultValue, nil
+	}
+	if _, ok := flags["size"]; ok {
+		return formatSize(fieldType, defaultValue)
+	}
+	switch t := fieldType.(type) {
+	case *ast.Ident:
+		if t.Name == "string" && resolver.quoteStrings {
+			return fmt.Sprintf("`%s`", defaultValue), nil
+		}
+	case *ast.SelectorExpr:
+		return formatKnownType(resolver, t, defaultValue, "")
+	case *ast.StarExpr:
+		if sel, ok := t.X.(*ast.SelectorExpr); ok && sel.Sel.Name == "URL" {
+			return formatKnownType(resolver, sel, defaultValue, "&")
+		}
+	}
+	return defaultValue, nil
+}
+
+// formatKnownType formats defaults for types from the standard library that have a well-known text form, importing
+// the package of the type.  Values that are not in the text form, such as "time.Second" for a duration, are used as
+// they are.
+func formatKnownType(resolver structResolver, t *ast.SelectorExpr, defaultValue string, prefix string) (string, error) {
+	pkg, ok := t.X.(*ast.Ident)
+	if !ok {
+		return defaultValue, nil
+	}
+	addImport := func(path string) {
+		if resolver.generated != nil && !slices.Contains(resolver.generated.imports, path) {
+			resolver.generated.imports = append(resolver.generated.imports, path)
+		}
+	}
+	switch pkg.Name + "." + t.Sel.Name {
+	case "time.Duration":
+		if d, err := time.ParseDuration(defaultValue); err == nil {
+			addImport("time")
+			return formatDuration(pkg.Name, d), nil
+		}
+	case "time.Time":
+		if tm, err := time.Parse(time.RFC3339Nano, defaultValue); err == nil {
+			addImport("time")
+			return formatTime(pkg.Name, tm), nil
+		}
+	case "url.URL":
+		u, err := url.Parse(defaultValue)
+		if err != nil {
+			return "", failf(`invalid URL default value "%s": %s`, defaultValue, err)
+		}
+		addImport("net/url")
+		return prefix + formatURL(pkg.Name, u), nil
+	case "net.IP":
+		if net.ParseIP(defaultValue) == nil {
+			return "", failf(`invalid IP address default value "%s"`, defaultValue)
+		}
+		addImport("net")
+		return fmt.Sprintf("%s.ParseIP(%q)", pkg.Name, defaultValue), nil
+	}
+	return defaultValue, nil
+}
+
+// formatDuration returns a duration as a multiple of the largest unit that divides it exactly (e.g. "90 * time.Second")
+func formatDuration(pkg string, d time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"Hour", time.Hour},
+		{"Minute", time.Minute},
+		{"Second", time.Second},
+		{"Millisecond", time.Millisecond},
+		{"Microsecond", time.Microsecond},
+		{"Nanosecond", time.Nanosecond},
+	}
+	if d == 0 {
+		return "0"
+	}
+	for _, u := range units {
+		if d%u.size == 0 {
+			return fmt.Sprintf("%d * %s.%s", d/u.size, pkg, u.name)
+		}
+	}
+	return strconv.FormatInt(int64(d), 10)
+}
+
+func formatTime(pkg string, t time.Time) string {
+	loc := pkg + ".UTC"
+	if _, offset := t.Zone(); offset != 0 {
+		loc = fmt.Sprintf("%s.FixedZone(%q, %d)", pkg, "", offset)
+	}
+	return fmt.Sprintf("%s.Date(%d, %d, %d, %d, %d, %d, %d, %s)",
+		pkg, t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+func formatURL(pkg string, u *url.URL) string {
+	var fields []string
+	add := func(name string, value string) {
+		if value != "" {
+			fields = append(fields, fmt.Sprintf("%s: %q", name, value))
+		}
+	}
+	add("Scheme", u.Scheme)
+	add("Opaque", u.Opaque)
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			fields = append(fields, fmt.Sprintf("User: %s.UserPassword(%q, %q)", pkg, u.User.Username(), password))
+		} else {
+			fields = append(fields, fmt.Sprintf("User: %s.User(%q)", pkg, u.User.Username()))
+		}
+	}
+	add("Host", u.Host)
+	add("Path", u.Path)
+	add("RawPath", u.RawPath)
+	add("RawQuery", u.RawQuery)
+	add("Fragment", u.Fragment)
+	add("RawFragment", u.RawFragment)
+	return fmt.Sprintf("%s.URL{%s}", pkg, strings.Join(fields, ", "))
+}
+
+var integerTypes = map[string]bool{
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+var sizePattern = regexp.MustCompile(`^([0-9]+)\s*([KMGTP]i?)?B?$`)
+
+var sizeMultipliers = map[string]int64{
+	"":   1,
+	"K":  1000,
+	"M":  1000 * 1000,
+	"G":  1000 * 1000 * 1000,
+	"T":  1000 * 1000 * 1000 * 1000,
+	"P":  1000 * 1000 * 1000 * 1000 * 1000,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+}
+
+// formatSize converts byte sizes such as "10MiB" or "5KB" into integers
+func formatSize(fieldType ast.Expr, defaultValue string) (string, error) {
+	if t, ok := fieldType.(*ast.Ident); !ok || !integerTypes[t.Name] {
+		return "", failf(`expected integer type for "size" flag with default value "%s"`, defaultValue)
+	}
+	match := sizePattern.FindStringSubmatch(defaultValue)
+	if match == nil {
+		return "", failf(`invalid size default value "%s", expected a value such as "10MiB"`, defaultValue)
+	}
+	n, err := strconv.ParseInt(match[1], 10, 64)
+	multiplier := sizeMultipliers[match[2]]
+	if err != nil || n > (1<<63-1)/multiplier {
+		return "", failf(`size default value "%s" is too large`, defaultValue)
+	}
+	return strconv.FormatInt(n*multiplier, 10), nil
+}
+
+// parseDefaultTag returns the default value given by the "default" tag of a field, if any.  The whole tag is used as
+// the value, so it may contain commas.  JSON values are converted into Go literals of the field's type, other values
+// of string fields are quoted unless quoting is disabled, and any other value must be a Go expression.
+func parseDefaultTag(fset *token.FileSet, resolver structResolver, field *ast.Field) (string, bool, error) {
+	if field.Tag == nil {
+		return "", false, nil
+	}
+	value, ok := reflect.StructTag(field.Tag.Value[1 : len(field.Tag.Value)-1]).Lookup("default")
+	if !ok || value == "" {
+		return "", false, nil
+	}
+	if !json.Valid([]byte(value)) {
+		if resolver.quoteStrings && isStringType(resolver, field.Type) {
+			return strconv.Quote(value), true, nil
+		}
+		if _, err := parser.ParseExpr(value); err != nil {
+			return "", false, failf(`default value %s is neither JSON nor a Go expression`, value)
+		}
+		return value, true, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return "", false, failf(`unable to decode default value %s: %s`, value, err)
+	}
+	literal, err := formatLiteral(fset, resolver, field.Type, v)
+	return literal, err == nil, err
+}
+
+// formatLiteral converts a decoded JSON value into a Go expression of the given type
+func formatLiteral(fset *token.FileSet, resolver structResolver, t ast.Expr, v interface{}) (string, error) {
+	typeStr := getType(fset, t)
+	if v == nil {
+		return "nil", nil
+	}
+	mismatch := func() (string, error) {
+		return "", failf(`default value %v cannot be used for type %s`, v, typeStr)
+	}
+	switch t := t.(type) {
+	case *ast.StarExpr:
+		switch x := t.X.(type) {
+		case *ast.ArrayType, *ast.MapType, *ast.StructType:
+			literal, err := formatLiteral(fset, resolver, x, v)
+			return "&" + literal, err
+		case *ast.Ident:
+			if _, ok := resolver.structs[x.Name]; ok {
+				literal, err := formatLiteral(fset, resolver, x, v)
+				return "&" + literal, err
+			}
+		}
+		elemType := getType(fset, t.X)
+		literal, err := formatLiteral(fset, resolver, t.X, v)
+		return fmt.Sprintf("func() %s { v := %s(%s); return &v }()", typeStr, elemType, literal), err
+	case *ast.ArrayType:
+		values, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		var elems []string
+		for _, e := range values {
+			elem, err := formatLiteral(fset, resolver, t.Elt, e)
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, elem)
+		}
+		return fmt.Sprintf("%s{%s}", typeStr, strings.Join(elems, ", ")), nil
+	case *ast.MapType:
+		values, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var entries []string
+		for _, k := range keys {
+			key := k
+			if isStringType(resolver, t.Key) {
+				key = strconv.Quote(k)
+			}
+			value, err := formatLiteral(fset, resolver, t.Value, values[k])
+			if err != nil {
+				return "", err
+			}
+			entries = append(entries, fmt.Sprintf("%s: %s", key, value))
+		}
+		return fmt.Sprintf("%s{%s}", typeStr, strings.Join(entries, ", ")), nil
+	case *ast.StructType:
+		return formatStructLiteral(fset, resolver, typeStr, t, v)
+	case *ast.Ident:
+		if st, ok := resolver.structs[t.Name]; ok {
+			return formatStructLiteral(fset, resolver, typeStr, st, v)
+		}
+	case *ast.SelectorExpr:
+		if s, ok := v.(string); ok {
+			formatted, err := formatKnownType(resolver, t, s, "")
+			if err != nil || formatted != s {
+				return formatted, err
+			}
+		}
+	}
+	switch v := v.(type) {
+	case json.Number:
+		return v.String(), nil
+	case string:
+		return strconv.Quote(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return mismatch()
+}
+
+// formatStructLiteral converts a JSON object keyed by field name into a struct literal
+func formatStructLiteral(fset *token.FileSet, resolver structResolver, typeStr string, st *ast.StructType, v interface{}) (string, error) {
+	values, ok := v.(map[string]interface{})
+	if !ok {
+		return "", failf(`default value %v cannot be used for type %s`, v, typeStr)
+	}
+	var elems []string
+	used := 0
+	for _, field := range st.Fields.List {
+		for _, n := range field.Names {
+			if value, ok := values[n.Name]; ok {
+				literal, err := formatLiteral(fset, resolver, field.Type, value)
+				if err != nil {
+					return "", err
+				}
+				elems = append(elems, fmt.Sprintf("%s: %s", n.Name, literal))
+				used++
+			}
+		}
+	}
+	if used != len(values) {
+		return "", failf(`default value %v has fields that are not in type %s`, v, typeStr)
+	}
+	return fmt.Sprintf("%s{%s}", typeStr, strings.Join(elems, ", ")), nil
+}
@@ -0,0 +1,166 @@
+package generator
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// Diagnostic is a problem found in a config type, positioned at the field or type that caused it
+type Diagnostic struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Type    string `json:"type,omitempty"`  // name of the config type
+	Field   string `json:"field,omitempty"` // name of the field, with a "." between the names of nested fields
+	Tag     string `json:"tag,omitempty"`   // struct tag of the field, if any
+	Message string `json:"message"`
+}
+
+// String formats the diagnostic like a compiler error (e.g. "sample.go:10:2: config.myInt: message (tag ...)")
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	if d.File != "" {
+		fmt.Fprintf(&b, "%s:%d:%d: ", d.File, d.Line, d.Column)
+	}
+	switch {
+	case d.Type != "" && d.Field != "":
+		fmt.Fprintf(&b, "%s.%s: ", d.Type, d.Field)
+	case d.Type != "":
+		fmt.Fprintf(&b, "%s: ", d.Type)
+	}
+	b.WriteString(d.Message)
+	if d.Tag != "" {
+		fmt.Fprintf(&b, " (tag `%s`)", d.Tag)
+	}
+	return b.String()
+}
+
+// Diagnostics is the error returned by Generate when problems are found in the config types
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	lines := make([]string, len(d))
+	for i, diag := range d {
+		lines[i] = diag.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// failure is an error that abandons the field or type being generated
+type failure struct {
+	err   error
+	field *ast.Field // field the failure concerns, if it isn't the one being parsed
+	pos   token.Pos  // position of the problem, if it is more precise than the position of the field
+}
+
+func (f failure) Error() string {
+	return f.err.Error()
+}
+
+// failf returns a failure concerning the field or type being parsed
+func failf(format string, args ...interface{}) error {
+	return failure{err: fmt.Errorf(format, args...)}
+}
+
+// asFailure returns err as a failure, which concerns the field or type being parsed if err isn't a failure already
+func asFailure(err error) failure {
+	var f failure
+	if errors.As(err, &f) {
+		return f
+	}
+	return failure{err: err}
+}
+
+// atField attributes a failure that doesn't concern a particular field to field
+func atField(field *ast.Field, err error) error {
+	if err == nil {
+		return nil
+	}
+	f := asFailure(err)
+	if f.field == nil {
+		f.field = field
+	}
+	return f
+}
+
+// diagnostics collects the problems found in the config types so that they can all be reported together
+type diagnostics struct {
+	fset     *token.FileSet
+	typeName string    // config type being generated
+	typePos  token.Pos // position of the config type, used when a problem has no better position
+	list     Diagnostics
+}
+
+// add records a failure concerning field, which may be nil for problems with the type as a whole
+func (d *diagnostics) add(f failure, field *ast.Field, fieldName string) {
+	diag := Diagnostic{Type: d.typeName, Field: fieldName, Message: f.err.Error()}
+	pos := f.pos
+	if field != nil {
+		if !pos.IsValid() {
+			pos = field.Pos()
+		}
+		if field.Tag != nil {
+			diag.Tag = strings.Trim(field.Tag.Value, "`")
+		}
+	}
+	if !pos.IsValid() {
+		pos = d.typePos
+	}
+	if pos.IsValid() {
+		position := d.fset.Position(pos)
+		diag.File, diag.Line, diag.Column = position.Filename, position.Line, position.Column
+	}
+	d.list = append(d.list, diag)
+}
+
+// sorted returns the diagnostics in the order of their positions, so that problems found after parsing the fields of a
+// type, such as conflicts between options, are reported among the problems with the fields
+func (d *diagnostics) sorted() Diagnostics {
+	slices.SortStableFunc(d.list, func(a, b Diagnostic) int {
+		return cmp.Or(strings.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	return d.list
+}
+
+// errorf records a problem with an option without abandoning the type, so that later problems are reported too
+func (d *diagnostics) errorf(o optionSpec, format string, args ...interface{}) {
+	d.add(failure{err: fmt.Errorf(format, args...)}, o.field, o.Name)
+}
+
+// missing records the type names that were not found, which have no position and are reported before the problems
+// with the types that were
+func (d *diagnostics) missing(typeNames []string, found map[string]bool) {
+	for _, n := range typeNames {
+		if !found[n] {
+			d.list = append(d.list, Diagnostic{Message: fmt.Sprintf(`unable to find type "%s"`, n)})
+		}
+	}
+}
+
+// addField records a failure returned while parsing field, naming any nested field it concerns after field
+func (d *diagnostics) addField(err error, fset *token.FileSet, field *ast.Field) {
+	f := asFailure(err)
+	name := fieldName(fset, field)
+	if f.field == nil || f.field == field || !f.field.Pos().IsValid() {
+		d.add(f, field, name)
+		return
+	}
+	d.add(f, f.field, name+"."+fieldName(fset, f.field))
+}
+
+// fieldName returns the names of a field, or its type if it is embedded
+func fieldName(fset *token.FileSet, field *ast.Field) string {
+	if len(field.Names) == 0 {
+		return getType(fset, field.Type)
+	}
+	names := make([]string, len(field.Names))
+	for i, n := range field.Names {
+		names[i] = n.Name
+	}
+	return strings.Join(names, ", ")
+}
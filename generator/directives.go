@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+// directivePrefix starts the comments in the doc comment of a config type that hold its settings, such as
+// "//options:prefix=Opt noerror=false"
+const directivePrefix = "//options:"
+
+// generateMarker is the directive marking the types to generate options for when packages are given by patterns.  It
+// may be followed by settings like any other directive.
+const generateMarker = directivePrefix + "generate"
+
+// directives are the settings given in the doc comment of a config type
+type directives struct {
+	comments []*ast.Comment
+	marked   bool // whether the type is marked with generateMarker
+}
+
+// findDirectives returns the directives in the doc comment of a type
+func findDirectives(doc *ast.CommentGroup) directives {
+	var d directives
+	if doc == nil {
+		return d
+	}
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, directivePrefix) {
+			continue
+		}
+		d.comments = append(d.comments, c)
+		if c.Text == generateMarker || strings.HasPrefix(c.Text, generateMarker+" ") {
+			d.marked = true
+		}
+	}
+	return d
+}
+
+// apply changes the config given on the command line with the settings of the directives.  Each setting has the name
+// of a command-line flag and is written as <name>=<value>, or just <name> to set a boolean flag to true.  Settings are
+// applied in order, so later settings override earlier ones.
+func (d directives) apply(cfg Config) (Config, error) {
+	fs := flag.NewFlagSet(directivePrefix, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg.RegisterFlags(fs)
+	for _, c := range d.comments {
+		fail := func(format string, args ...interface{}) (Config, error) {
+			return cfg, failure{err: fmt.Errorf(format, args...), pos: c.Pos()}
+		}
+		settings := strings.Fields(strings.TrimPrefix(c.Text, directivePrefix))
+		if len(settings) > 0 && settings[0] == "generate" {
+			settings = settings[1:]
+		}
+		for _, s := range settings {
+			name, value, hasValue := strings.Cut(s, "=")
+			f := fs.Lookup(name)
+			if f == nil || name == "type" || name == "input" {
+				return fail(`unknown setting "%s" in %s directive`, name, directivePrefix)
+			}
+			if !hasValue {
+				if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+					return fail(`setting "%s" in %s directive requires a value`, name, directivePrefix)
+				}
+				value = "true"
+			}
+			if err := fs.Set(name, value); err != nil {
+				return fail(`invalid value "%s" for setting "%s" in %s directive`, value, name, directivePrefix)
+			}
+		}
+	}
+	return cfg, nil
+}
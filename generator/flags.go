@@ -0,0 +1,35 @@
+package generator
+
+import "flag"
+
+// RegisterFlags defines a command-line flag in fs for each setting of c, using the current values of c as defaults
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.TypeName, "type", c.TypeName, "name of struct to create options for")
+	fs.BoolVar(&c.CreateNewFunc, "new", c.CreateNewFunc, "whether to create a function to return a new config")
+	fs.StringVar(&c.OptionInterfaceName, "option", c.OptionInterfaceName, "name of the interface to use for options")
+	fs.StringVar(&c.Imports, "imports", c.Imports, "a comma-separated list of packages with optional alias (e.g. time,url=net/url) ")
+	fs.StringVar(&c.InputFileName, "input", c.InputFileName, "name of input file")
+	fs.StringVar(&c.OutputName, "output", c.OutputName, "name of output file (default is <type>_options.go)")
+	fs.StringVar(&c.ApplyFunctionName, "func", c.ApplyFunctionName, `name of function created to apply options to <type> (default is "apply<Type>Options")`)
+	fs.StringVar(&c.ApplyOptionFunctionType, "option_func", c.ApplyOptionFunctionType,
+		`name of function type created to apply options with pointer receiver to <type> (default is "apply<Option>Func")`)
+	fs.StringVar(&c.OptionPrefix, "prefix", c.OptionPrefix, `name of prefix to use for options (default is the same as "option")`)
+	fs.StringVar(&c.OptionSuffix, "suffix", c.OptionSuffix, `name of suffix to use for options (forces use of suffix, cannot with used with prefix)`)
+	fs.StringVar(&c.BuildTag, "build", c.BuildTag, `build tags to add at the top of the file`)
+	fs.BoolVar(&c.QuoteStrings, "quote-default-strings", c.QuoteStrings, `set to false to disable automatic quoting of string field defaults`)
+	fs.BoolVar(&c.ImplementString, "stringer", c.ImplementString, `set to false to disable creating String() method for options`)
+	fs.BoolVar(&c.ImplementEqual, "cmp", c.ImplementEqual, `set to false to disable creating Equals() method for options`)
+	fs.BoolVar(&c.ReturnError, "noerror", c.ReturnError, `set to false if you do not want to return an error when creating a new config`)
+	fs.BoolVar(&c.RunGoFmt, "fmt", c.RunGoFmt, `set to false to skip go format`)
+	fs.BoolVar(&c.NewFuncPublic, "public", c.NewFuncPublic, `set to true to make the 'new' function public`)
+	fs.BoolVar(&c.TrackOptions, "track", c.TrackOptions,
+		`set to true to record which options were applied in a field of type <type>SetOptions`)
+	fs.BoolVar(&c.LoadEnv, "env", c.LoadEnv, `set to true to create an option that reads fields with "env" tags from the environment`)
+	fs.BoolVar(&c.BindFlags, "flags", c.BindFlags, `set to true to create a function that registers a flag for each option in a flag.FlagSet`)
+	fs.BoolVar(&c.DecodeDocuments, "decode", c.DecodeDocuments, `set to true to create options that decode JSON and YAML documents keyed by option names`)
+	fs.BoolVar(&c.DecodeYAML, "yaml", c.DecodeYAML, `set to false to decode only JSON documents with -decode, without importing gopkg.in/yaml.v3`)
+	fs.BoolVar(&c.MarshalOptions, "marshal", c.MarshalOptions, `set to true to create MarshalJSON methods for options and a function that unmarshals them`)
+	fs.BoolVar(&c.ToOptions, "to-options", c.ToOptions, `set to true to create an Options() method returning the options that reproduce a config`)
+	fs.BoolVar(&c.DiffConfigs, "diff", c.DiffConfigs, `set to true to create a function that reports the options that differ between two configs`)
+	fs.BoolVar(&c.Combinators, "combinators", c.Combinators, `set to true to create options that group other options, apply them conditionally or do nothing`)
+}
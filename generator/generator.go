@@ -0,0 +1,1866 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/structtag"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Config holds the settings of the generator, which mirror the command-line flags of go-options
+type Config struct {
+	TypeNames               []string // names of the struct types to create options for
+	TypeName                string   // name of a struct type to create options for (the original -type flag)
+	Patterns                []string // patterns of the packages to load, such as "./...", instead of the package in Dir
+	Dir                     string   // directory of the package to load, which defaults to the current directory
+	OptionInterfaceName     string
+	OutputName              string // name of the output file, which defaults to <type>_options.go
+	InputFileName           string // file to parse instead of loading the package, which is faster but less capable
+	ApplyFunctionName       string
+	ApplyOptionFunctionType string
+	CreateNewFunc           bool
+	RunGoFmt                bool
+	OptionPrefix            string
+	OptionSuffix            string
+	BuildTag                string
+	Imports                 string // comma-separated packages with optional aliases (e.g. time,url=net/url)
+	QuoteStrings            bool
+	ImplementEqual          bool
+	ImplementString         bool
+	ReturnError             bool
+	NewFuncPublic           bool
+	TrackOptions            bool
+	LoadEnv                 bool
+	BindFlags               bool
+	DecodeDocuments         bool
+	DecodeYAML              bool // whether DecodeDocuments also creates an option decoding YAML, which imports yaml.v3
+	MarshalOptions          bool
+	ToOptions               bool
+	DiffConfigs             bool
+	Combinators             bool
+}
+
+// DefaultConfig returns a Config with the same defaults as the command-line flags
+func DefaultConfig() Config {
+	return Config{
+		OptionInterfaceName: "Option",
+		CreateNewFunc:       true,
+		RunGoFmt:            true,
+		QuoteStrings:        true,
+		ImplementEqual:      true,
+		ImplementString:     true,
+		ReturnError:         true,
+		DecodeYAML:          true,
+	}
+}
+
+// GeneratedFile is the content of a file created by Generate
+type GeneratedFile struct {
+	Name    string // path of the file, relative to the current directory unless Config.Dir is absolute
+	Content []byte
+}
+
+// fieldSpec is a parameter of an option and the field that it sets
+type fieldSpec struct {
+	Name         string
+	ParamName    string
+	ParamType    string
+	Type         string
+	DefaultValue string
+	Append       bool
+	Clone        string // package whose Clone function copies a map or slice value, so configs do not share it
+	CheckLength  bool   // whether validations check the length of an "append" field after the values are appended
+	Validations  []validation
+}
+
+// validation is a check generated in the apply method of an option
+type validation struct {
+	Check   string // expression that is true when the value is invalid
+	Message string
+}
+
+// optionSpec describes an option generated for a field of the config
+type optionSpec struct {
+	Name         string
+	PublicName   string
+	FuncName     string // name of the generated option constructor
+	ImplName     string // name of the generated option type
+	TrackName    string // name of the field recording whether the option was applied
+	DefaultValue string
+	Fields       []fieldSpec
+	Docs         []string
+	DefaultIsNil bool
+	IsStruct     bool
+	IsMapEntry   bool
+	Required     bool
+	Exclusive    []string // groups of options that cannot be combined
+	Requires     []string // public names of options that must also be applied
+	EnvFields    []envField
+	FlagFields   []flagField
+	CanMarshal   bool   // whether the arguments of the option can round-trip through JSON
+	CopyCheck    string // condition under which Options() returns the option, which is always returned if it is empty
+	Type         string
+	field        *ast.Field // field declaring the option, used to position diagnostics
+	imports      []string   // packages of the types of fields promoted from other packages
+}
+
+// valueParser describes how to parse a string into the value of a field
+type valueParser struct {
+	Parse     string // format of the expression parsing a string, if it isn't a string already
+	Convert   string // type the parsed value is converted to
+	FlagFunc  string // name of the flag.FlagSet method defining a flag for a single value
+	FlagType  string // type of the value defined by FlagFunc
+	FlagRange string // format of the condition that a value of FlagType is out of the range of the type, if it can be
+	IsSlice   bool
+}
+
+// envField describes how to read a field set by an option from an environment variable
+type envField struct {
+	valueParser
+	Name       string // name of the variable, which is prefixed at runtime
+	Field      string // name of the field set by the variable, for the fields of struct options
+	IsVariadic bool   // whether the option takes the slice as variadic arguments
+	Separator  string
+}
+
+// flagField describes a command-line flag for a field set by an option
+type flagField struct {
+	valueParser
+	Name       string // name of the flag
+	Var        string // name of the field holding the parsed value
+	Field      string // name of the field set by the flag, for the fields of struct options
+	Usage      string
+	Default    string // default value of the flag, which is the zero value if empty
+	IsVariadic bool   // whether the option takes the slice as variadic arguments
+}
+
+// defaultValue is the default value of a field set by an option
+type defaultValue struct {
+	FuncName string // name of the option setting the field
+	Field    string // selector for the field from the config
+	Default  string
+}
+
+// optionPair is a pair of options that conflict or where the first requires the second
+type optionPair struct {
+	First  optionSpec
+	Second optionSpec
+}
+
+// importSpec is a package imported by the generated file
+type importSpec struct {
+	Alias string
+	Path  string
+}
+
+// structResolver finds the definitions of structs embedded in a config type
+type structResolver struct {
+	structs       map[string]*ast.StructType // struct types declared in the source files
+	typesInfo     *types.Info                // only available when loaded with packages.Load
+	pkg           *types.Package
+	checkDefaults bool // whether default values can be type-checked against pkg
+	quoteStrings  bool // whether default values of string fields are quoted
+	diags         *diagnostics
+	generated     *generatedCode    // code needed outside of the options of the type being generated
+	outputs       map[string]string // config types generated so far, keyed by the names of their files
+}
+
+// generatedCode collects the package-level variables and imports needed by the options of a type
+type generatedCode struct {
+	patterns []pattern // regular expressions compiled once into package-level variables
+	imports  []string  // packages used by default values
+}
+
+// pattern is a regular expression compiled once into a package-level variable by the generated code
+type pattern struct {
+	Name string // name of the variable
+	Expr string // quoted regular expression
+}
+
+// Generate creates the options files for the types in cfg without writing them.  Problems found in the types are
+// returned as Diagnostics, along with the files of any types that had no problems.
+func Generate(ctx context.Context, cfg Config) (files []GeneratedFile, err error) {
+	typeNames := cfg.TypeNames
+	if cfg.OptionPrefix != "" && cfg.OptionSuffix != "" {
+		return nil, errors.New("cannot specify both -prefix and -suffix options")
+	}
+
+	if cfg.TypeName != "" {
+		typeNames = append(typeNames, cfg.TypeName)
+	}
+
+	if len(typeNames) == 0 && len(cfg.Patterns) == 0 {
+		return nil, errors.New("missing arguments")
+	}
+
+	if cfg.InputFileName != "" {
+		if len(cfg.Patterns) > 0 {
+			return nil, errors.New("cannot use package patterns with -input")
+		}
+		return runWithInputFile(cfg, typeNames)
+	}
+
+	pkgs, err := packages.Load(&packages.Config{
+		Context: ctx,
+		Dir:     cfg.Dir,
+		Mode:    packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedName | packages.NeedImports | packages.NeedDeps,
+		Tests:   false,
+	}, cfg.Patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %s", err)
+	}
+
+	if len(cfg.Patterns) == 0 && len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected a single package but %d packages were found", len(pkgs))
+	}
+
+	slices.SortFunc(pkgs, func(a, b *packages.Package) int { return strings.Compare(a.PkgPath, b.PkgPath) })
+
+	var diags *diagnostics
+	outputs := make(map[string]string)
+	found := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if diags == nil {
+			diags = &diagnostics{fset: pkg.Fset}
+		}
+		resolver := structResolver{
+			structs:      findStructs(pkg.Syntax...),
+			typesInfo:    pkg.TypesInfo,
+			pkg:          pkg.Types,
+			quoteStrings: cfg.QuoteStrings,
+			diags:        diags,
+			outputs:      outputs,
+		}
+		pkgCfg := cfg
+		if len(cfg.Patterns) > 0 && len(pkg.Syntax) > 0 {
+			// files are written next to the package rather than in Dir
+			pkgCfg.Dir = relativeDir(pkg.Fset.File(pkg.Syntax[0].Pos()).Name())
+		}
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(node ast.Node) bool {
+				decl, ok := node.(*ast.GenDecl)
+				if !ok || decl.Tok != token.TYPE {
+					return true
+				}
+				generated, names := generateOptionsFiles(pkgCfg, typeNames, pkg.Name, decl, pkg.Fset, resolver)
+				files = append(files, generated...)
+				for _, n := range names {
+					found[n] = true
+				}
+				return false
+			})
+		}
+	}
+
+	if len(cfg.Patterns) > 0 && len(found) == 0 {
+		return nil, fmt.Errorf("no types marked with %s were found in %s", generateMarker, strings.Join(cfg.Patterns, " "))
+	}
+	if diags == nil {
+		diags = &diagnostics{}
+	}
+	diags.missing(typeNames, found)
+	if len(diags.list) > 0 {
+		return files, diags.sorted()
+	}
+	return files, nil
+}
+
+// relativeDir returns the directory of a file, relative to the current directory if possible
+func relativeDir(fileName string) string {
+	dir := filepath.Dir(fileName)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, dir); err == nil {
+			return rel
+		}
+	}
+	return dir
+}
+
+// runWithInputFile is an alternative to packages.Load because packages.Load requires a full go driver
+// runWithInputFile uses "go/build" and "go/parser" directly, but requires a file name to be passed.
+// This limits the number of required dependencies, and speeds up generation times
+func runWithInputFile(cfg Config, typeNames []string) ([]GeneratedFile, error) {
+	fset := token.NewFileSet()
+
+	src := cfg.InputFileName
+	if cfg.Dir != "" && !filepath.IsAbs(src) {
+		src = filepath.Join(cfg.Dir, src)
+	}
+	if ok, err := build.Default.MatchFile(filepath.Dir(src), filepath.Base(src)); err != nil {
+		return nil, fmt.Errorf("error checking if file matches constraint %w", err)
+	} else if !ok || filepath.Ext(src) == ".s" {
+		return nil, nil
+	}
+	f, err := parser.ParseFile(fset, src, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %q %w", src, err)
+	}
+	if f.Name == nil || f.Name.Name == "" {
+		return nil, fmt.Errorf("error parsing %q: no name in file", src)
+	}
+	inferedPackage := f.Name.Name
+	resolver := structResolver{
+		structs:      findStructs(f),
+		quoteStrings: cfg.QuoteStrings,
+		diags:        &diagnostics{fset: fset},
+		outputs:      make(map[string]string),
+	}
+	var files []GeneratedFile
+	found := make(map[string]bool)
+	ast.Inspect(f, func(node ast.Node) bool {
+		decl, ok := node.(*ast.GenDecl)
+		if !ok || decl.Tok != token.TYPE {
+			return true
+		}
+		generated, names := generateOptionsFiles(cfg, typeNames, inferedPackage, decl, fset, resolver)
+		files = append(files, generated...)
+		for _, n := range names {
+			found[n] = true
+		}
+		return false
+	})
+	resolver.diags.missing(typeNames, found)
+	if len(resolver.diags.list) > 0 {
+		return files, resolver.diags.sorted()
+	}
+	return files, nil
+}
+
+// generateOptionsFiles creates an options file for each of the types declared by decl that are in typeNames or, if no
+// type names are given, that are marked with the generateMarker directive.  It returns the names of the types it found.
+func generateOptionsFiles(cfg Config, typeNames []string, packageName string, decl *ast.GenDecl, fset *token.FileSet, resolver structResolver) (files []GeneratedFile, found []string) {
+	for _, spec := range decl.Specs {
+		typeSpec := spec.(*ast.TypeSpec)
+		doc := typeSpec.Doc
+		if doc == nil && len(decl.Specs) == 1 {
+			doc = decl.Doc
+		}
+		directives := findDirectives(doc)
+
+		typeName := typeSpec.Name.Name
+		if len(typeNames) > 0 && !slices.Contains(typeNames, typeName) || len(typeNames) == 0 && !directives.marked {
+			continue
+		}
+		if _, isStruct := typeSpec.Type.(*ast.StructType); !isStruct && !directives.marked {
+			continue
+		}
+		found = append(found, typeName)
+
+		if file, ok := generateOptionsFile(cfg, typeName, typeSpec, directives, packageName, fset, resolver); ok {
+			files = append(files, file)
+		}
+	}
+
+	return files, found
+}
+
+// generateOptionsFile creates the options file for a config type.  Problems with the type are recorded as diagnostics
+// and no file is created for it.
+func generateOptionsFile(cfg Config, typeName string, typeSpec *ast.TypeSpec, directives directives, packageName string, fset *token.FileSet, resolver structResolver) (file GeneratedFile, ok bool) {
+	diags := resolver.diags
+	diags.typeName, diags.typePos = typeName, typeSpec.Pos()
+	reported := len(diags.list)
+	fail := func(err error) (GeneratedFile, bool) {
+		f := asFailure(err)
+		var name string
+		if f.field != nil {
+			name = fieldName(fset, f.field)
+		}
+		diags.add(f, f.field, name)
+		return GeneratedFile{}, false
+	}
+
+	t, ok := typeSpec.Type.(*ast.StructType)
+	if !ok {
+		return fail(failf("only struct types can be marked with %s", generateMarker))
+	}
+	if len(directives.comments) > 0 {
+		var err error
+		if cfg, err = directives.apply(cfg); err != nil {
+			return fail(err)
+		}
+		if cfg.OptionPrefix != "" && cfg.OptionSuffix != "" {
+			return fail(failf("cannot specify both -prefix and -suffix options"))
+		}
+		resolver.quoteStrings = cfg.QuoteStrings
+	}
+
+	generated := &generatedCode{}
+	resolver.generated = generated
+
+	typeParams, typeArgs := getTypeParams(fset, typeSpec.TypeParams)
+
+	// fields using type parameters can't be type-checked in the package scope
+	resolver.checkDefaults = resolver.pkg != nil && typeParams == ""
+
+	fieldList := t.Fields.List
+	setOptionsType := typeName + "SetOptions"
+	var setOptionsField string
+	if cfg.TrackOptions {
+		fieldList = nil
+		for _, field := range t.Fields.List {
+			if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == setOptionsType && len(field.Names) == 1 {
+				setOptionsField = field.Names[0].Name
+				continue
+			}
+			fieldList = append(fieldList, field)
+		}
+		if setOptionsField == "" {
+			return fail(failf(`-track requires a field of type %s`, setOptionsType))
+		}
+	}
+
+	options, err := parseOptions(fset, resolver, fieldList, "", "")
+	if err != nil {
+		return fail(err)
+	}
+
+	prefix := cfg.OptionInterfaceName
+	if cfg.OptionPrefix != "" {
+		prefix = cfg.OptionPrefix
+	}
+	for i, o := range options {
+		options[i].FuncName = prefix + toPublic(o.PublicName)
+		if cfg.OptionSuffix != "" {
+			options[i].FuncName = toPublic(o.PublicName) + cfg.OptionSuffix
+		}
+		options[i].ImplName = toPrivate(options[i].FuncName + "Impl")
+		options[i].TrackName = strings.ReplaceAll(o.Name, ".", "_")
+	}
+	created := make(map[string]optionSpec)
+	for _, o := range options {
+		if other, ok := created[o.FuncName]; ok {
+			diags.errorf(o, `option "%s" is also created for field %s`, o.FuncName, other.Name)
+			continue
+		}
+		created[o.FuncName] = o
+	}
+
+	var defaults []defaultValue
+	for _, o := range options {
+		if o.DefaultValue != "" {
+			defaults = append(defaults, defaultValue{FuncName: o.FuncName, Field: o.Name, Default: o.DefaultValue})
+		}
+		// the fields of struct options that default to nil have no defaults until the option is applied
+		if !o.IsStruct || o.DefaultIsNil {
+			continue
+		}
+		for _, f := range o.Fields {
+			if f.DefaultValue != "" {
+				defaults = append(defaults, defaultValue{FuncName: o.FuncName, Field: o.Name + "." + f.Name, Default: f.DefaultValue})
+			}
+		}
+	}
+	defaultsName := toPrivate(typeName) + "Defaults"
+	if cfg.NewFuncPublic {
+		defaultsName = toPublic(typeName) + "Defaults"
+	}
+
+	var importList []importSpec
+	if cfg.Imports != "" {
+		for _, s := range strings.Split(cfg.Imports, ",") {
+			parts := strings.Split(s, "=")
+			if len(parts) == 1 {
+				importList = append(importList, importSpec{Path: parts[0]})
+			} else if len(parts) == 2 {
+				importList = append(importList, importSpec{Alias: parts[0], Path: parts[1]})
+			} else {
+				return fail(failf(`unexpected import description "%s"`, s))
+			}
+		}
+	}
+
+	var extraImports []string
+	importFmt := cfg.ImplementString && len(options) > 0
+	addImport := func(path string) {
+		if path == "fmt" {
+			importFmt = true
+			return
+		}
+		if slices.Contains(importList, importSpec{Path: path}) || slices.Contains(extraImports, path) {
+			return
+		}
+		extraImports = append(extraImports, path)
+	}
+	for _, o := range options {
+		for _, path := range o.imports {
+			addImport(path)
+		}
+	}
+	for _, o := range options {
+		for _, f := range o.Fields {
+			if len(f.Validations) > 0 && !cfg.ReturnError {
+				diags.errorf(o, `validation requires returning errors and cannot be used with -noerror=false`)
+				break
+			}
+			if len(f.Validations) > 0 {
+				addImport("errors")
+			}
+		}
+	}
+	if len(generated.patterns) > 0 {
+		addImport("regexp")
+	}
+	for _, path := range generated.imports {
+		addImport(path)
+	}
+
+	var requiredOptions []optionSpec
+	trackedNames := make(map[string]bool)
+	for _, o := range options {
+		if o.Required {
+			if !cfg.ReturnError {
+				diags.errorf(o, `required options require returning errors and cannot be used with -noerror=false`)
+			}
+			requiredOptions = append(requiredOptions, o)
+			trackedNames[o.Name] = true
+			addImport("errors")
+			addImport("strings")
+		}
+	}
+	var conflicts, dependencies []optionPair
+	groups := make(map[string][]optionSpec)
+	var groupNames []string
+	for _, o := range options {
+		if o.IsMapEntry {
+			continue
+		}
+		for _, g := range o.Exclusive {
+			for _, other := range groups[g] {
+				conflicts = append(conflicts, optionPair{First: other, Second: o})
+			}
+			if groups[g] == nil {
+				groupNames = append(groupNames, g)
+			}
+			groups[g] = append(groups[g], o)
+		}
+		for _, r := range o.Requires {
+			i := slices.IndexFunc(options, func(other optionSpec) bool {
+				return !other.IsMapEntry && (other.PublicName == r || other.Name == r)
+			})
+			if i < 0 {
+				diags.errorf(o, `option "%s" requires unknown option "%s"`, o.FuncName, r)
+				continue
+			}
+			dependencies = append(dependencies, optionPair{First: o, Second: options[i]})
+		}
+	}
+	for _, g := range groupNames {
+		if len(groups[g]) < 2 {
+			diags.errorf(groups[g][0], `exclusive group "%s" only contains option "%s"`, g, groups[g][0].FuncName)
+		}
+	}
+	pairs := append(conflicts, dependencies...)
+	if len(pairs) > 0 && !cfg.ReturnError {
+		diags.errorf(pairs[0].Second, `exclusive and dependent options require returning errors and cannot be used with -noerror=false`)
+	}
+	for _, p := range pairs {
+		trackedNames[p.First.Name] = true
+		trackedNames[p.Second.Name] = true
+		addImport("errors")
+	}
+
+	var envOptions []optionSpec
+	if cfg.LoadEnv {
+		for _, o := range options {
+			if len(o.EnvFields) == 0 {
+				continue
+			}
+			if !cfg.ReturnError {
+				diags.errorf(o, `-env requires returning errors and cannot be used with -noerror=false`)
+			}
+			envOptions = append(envOptions, o)
+			for _, e := range o.EnvFields {
+				addImport("os")
+				if e.Parse != "" {
+					addImport("fmt")
+				}
+				if strings.HasPrefix(e.Parse, "strconv.") {
+					addImport("strconv")
+				}
+				if e.IsSlice {
+					addImport("strings")
+				}
+			}
+		}
+	}
+
+	var flagOptions []optionSpec
+	if cfg.BindFlags {
+		for _, o := range options {
+			if len(o.FlagFields) == 0 {
+				continue
+			}
+			if !cfg.ReturnError {
+				diags.errorf(o, `-flags requires returning errors and cannot be used with -noerror=false`)
+			}
+			flagOptions = append(flagOptions, o)
+			for _, f := range o.FlagFields {
+				addImport("flag")
+				if f.IsSlice && strings.HasPrefix(f.Parse, "strconv.") {
+					addImport("strconv")
+				}
+				if !f.IsSlice && f.FlagRange != "" {
+					addImport("fmt")
+					addImport("math")
+				}
+			}
+		}
+	}
+
+	var documentFormats []string
+	if cfg.DecodeDocuments {
+		if !cfg.ReturnError {
+			return fail(failf(`-decode requires returning errors and cannot be used with -noerror=false`))
+		}
+		documentFormats = append(documentFormats, "JSON")
+		addImport("bytes")
+		addImport("encoding/json")
+		addImport("fmt")
+		addImport("maps")
+		addImport("slices")
+		if cfg.DecodeYAML {
+			documentFormats = append(documentFormats, "YAML")
+			addImport("gopkg.in/yaml.v3")
+		}
+	}
+
+	if cfg.MarshalOptions {
+		if !cfg.ReturnError {
+			return fail(failf(`-marshal requires returning errors and cannot be used with -noerror=false`))
+		}
+		addImport("encoding/json")
+		addImport("fmt")
+		if len(envOptions) > 0 || len(flagOptions) > 0 || cfg.DecodeDocuments || cfg.Combinators {
+			addImport("errors")
+		}
+		for _, o := range options {
+			if !o.CanMarshal {
+				addImport("errors")
+			}
+		}
+	}
+
+	if cfg.ToOptions {
+		targets := make(map[string]bool)
+		for _, p := range dependencies {
+			targets[p.Second.Name] = true
+		}
+		for i, o := range options {
+			if o.IsMapEntry {
+				continue
+			}
+			// required options and the options that others require are returned even if they have their default value, so
+			// that the config can be rebuilt, unless they are exclusive and could conflict with other returned options
+			always := o.Required || targets[o.Name] && len(o.Exclusive) == 0
+			options[i].CopyCheck = copyCheck(o, always, setOptionsField)
+			if strings.Contains(options[i].CopyCheck, "reflect.") {
+				addImport("reflect")
+			}
+			for _, f := range o.Fields {
+				if f.Clone != "" {
+					addImport(f.Clone)
+				}
+			}
+		}
+	}
+	if cfg.Combinators {
+		for _, o := range options {
+			for _, name := range []string{"Group", "If", "None"} {
+				if o.FuncName == cfg.OptionInterfaceName+name {
+					diags.errorf(o, `option "%s" conflicts with the option created by -combinators`, o.FuncName)
+				}
+			}
+		}
+		if cfg.ImplementString {
+			addImport("fmt")
+		}
+	}
+	if cfg.DiffConfigs {
+		addImport("fmt")
+		addImport("strings")
+		if !cfg.ImplementEqual {
+			addImport("github.com/google/go-cmp/cmp")
+		}
+	}
+
+	var trackedOptions []optionSpec
+	for _, o := range options {
+		if trackedNames[o.Name] || setOptionsField != "" {
+			trackedOptions = append(trackedOptions, o)
+		}
+	}
+
+	outputFileName := fmt.Sprintf("%s_options.go", typeSpec.Name)
+	if cfg.OutputName != "" {
+		outputFileName = cfg.OutputName
+	}
+
+	if len(diags.list) > reported {
+		return GeneratedFile{}, false
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if cfg.BuildTag != "" {
+		buf.WriteString(fmt.Sprintf("//go:build %s\n\n", cfg.BuildTag))
+	}
+
+	buf.WriteString(fmt.Sprintf("package %s\n\n", packageName))
+
+	err = codeTemplate.Execute(buf, map[string]interface{}{
+		"imports":             importList,
+		"options":             options,
+		"optionTypeName":      cfg.OptionInterfaceName,
+		"configTypeName":      typeName,
+		"typeParams":          typeParams,
+		"typeArgs":            typeArgs,
+		"optionPrefix":        prefix,
+		"optionSuffix":        cfg.OptionSuffix,
+		"applyFuncName":       cfg.ApplyFunctionName,
+		"applyOptionFuncName": cfg.ApplyOptionFunctionType,
+		"createNewFunc":       cfg.CreateNewFunc,
+		"implementEqual":      cfg.ImplementEqual,
+		"implementString":     cfg.ImplementString,
+		"returnError":         cfg.ReturnError,
+		"newFuncPublic":       cfg.NewFuncPublic,
+		"extraImports":        extraImports,
+		"defaults":            defaults,
+		"defaultsName":        defaultsName,
+		"patterns":            generated.patterns,
+		"requiredOptions":     requiredOptions,
+		"trackedOptions":      trackedOptions,
+		"checkedNames":        trackedNames,
+		"setOptionsField":     setOptionsField,
+		"setOptionsType":      setOptionsType,
+		"conflicts":           conflicts,
+		"dependencies":        dependencies,
+		"importFmt":           importFmt,
+		"loadEnv":             cfg.LoadEnv,
+		"envOptions":          envOptions,
+		"flagOptions":         flagOptions,
+		"decodeDocuments":     cfg.DecodeDocuments,
+		"documentFormats":     documentFormats,
+		"marshalOptions":      cfg.MarshalOptions,
+		"toOptions":           cfg.ToOptions,
+		"diffConfigs":         cfg.DiffConfigs,
+		"combinators":         cfg.Combinators,
+		"optionLists":         len(envOptions) > 0 || len(flagOptions) > 0 || cfg.DecodeDocuments || cfg.Combinators,
+	})
+	if err != nil {
+		return fail(failf("template execute failed: %s", err))
+	}
+	content := buf.Bytes()
+	if cfg.RunGoFmt {
+		if content, err = format.Source(content); err != nil {
+			return fail(failf("gofmt failed: %s", err))
+		}
+	}
+	if cfg.Dir != "" && !filepath.IsAbs(outputFileName) {
+		outputFileName = filepath.Join(cfg.Dir, outputFileName)
+	}
+	if other, ok := resolver.outputs[filepath.Clean(outputFileName)]; ok {
+		return fail(failf(`output file %s is also generated for type %s, use -output to choose another name`, outputFileName, other))
+	}
+	resolver.outputs[filepath.Clean(outputFileName)] = typeName
+	return GeneratedFile{Name: outputFileName, Content: content}, true
+}
+
+// copyCheck returns the condition under which the Options() method returns an option, or "" if it is always returned.
+// Options that aren't always returned are returned if they differ from their defaults or, when the config tracks
+// options, if they were applied.  Options for fields with the "append" flag are only returned if the fields start with
+// their defaults, which are left out of the arguments.
+func copyCheck(o optionSpec, always bool, setOptionsField string) string {
+	var checks []string
+	if o.DefaultIsNil {
+		checks = append(checks, fmt.Sprintf("c.%s != nil", o.Name))
+	}
+	if !always {
+		changed := fmt.Sprintf("!reflect.DeepEqual(c.%s, d.%s)", o.Name, o.Name)
+		if setOptionsField != "" {
+			changed = fmt.Sprintf("(c.%s.%s || %s)", setOptionsField, o.TrackName, changed)
+		}
+		checks = append(checks, changed)
+	}
+	for _, f := range o.Fields {
+		if f.Append && !o.DefaultIsNil {
+			field := strings.TrimSuffix(o.Name+"."+f.Name, ".")
+			checks = append(checks, fmt.Sprintf("len(c.%s) >= len(d.%s)", field, field))
+		}
+	}
+	return strings.Join(checks, " && ")
+}
+
+// parseOptions creates an option for each field in fieldList, promoting the fields of embedded structs.
+// path is the selector used to reach the fields from the config and namePrefix is prepended to each public name.
+// Problems with a field are recorded as diagnostics and the field is skipped, so that the problems with the remaining
+// fields are reported too.  Fields without a position, such as those of structs in other packages, return the problem
+// to the field embedding them.
+func parseOptions(fset *token.FileSet, resolver structResolver, fieldList []*ast.Field, path string, namePrefix string) ([]optionSpec, error) {
+	var options []optionSpec
+	for _, field := range fieldList {
+		fieldOptions, err := parseField(fset, resolver, field, path, namePrefix)
+		if err != nil {
+			if !field.Pos().IsValid() {
+				return nil, err
+			}
+			resolver.diags.addField(err, fset, field)
+			continue
+		}
+		options = append(options, fieldOptions...)
+	}
+	return options, nil
+}
+
+// parseField creates the options for a single field
+func parseField(fset *token.FileSet, resolver structResolver, field *ast.Field, path string, namePrefix string) ([]optionSpec, error) {
+	publicName, defaultValue, flags, skip, err := parseStructTag(resolver, field)
+	if err != nil || skip {
+		return nil, err
+	}
+	if len(field.Names) == 0 {
+		if defaultValue != "" {
+			return nil, failf(`cannot use a default value for an embedded field`)
+		}
+		return parseEmbeddedOptions(fset, resolver, field.Type, path, joinName(namePrefix, publicName))
+	}
+	docs := fieldDocs(field)
+
+	typeStr := getType(fset, field.Type)
+
+	fieldType := field.Type
+	valueType := field.Type
+	defaultIsNil := false
+	if t, isStar := fieldType.(*ast.StarExpr); isStar {
+		switch t.X.(type) {
+		case *ast.StructType, *ast.ArrayType:
+			fieldType = t.X
+			valueType = t.X
+			defaultIsNil = true
+			typeStr = getType(fset, t.X)
+		default:
+			if strings.HasPrefix(publicName, "*") {
+				publicName = publicName[1:]
+				valueType = t.X
+				typeStr = getType(fset, t.X)
+				defaultIsNil = true
+			}
+		}
+	}
+	paramType := typeStr
+
+	var envFields []envField
+	env, ok, err := parseEnvTag(fset, field, valueType)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		env.IsVariadic = strings.HasSuffix(publicName, "...")
+		envFields = append(envFields, env)
+	}
+	var flagFields []flagField
+	f, ok, err := parseFlagTag(fset, field, valueType, docs)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		f.IsVariadic = strings.HasSuffix(publicName, "...")
+		flagFields = append(flagFields, f)
+	}
+
+	isStruct := false
+	var fields []fieldSpec
+	switch t := fieldType.(type) {
+	case *ast.StructType:
+		isStruct = true
+		for _, flag := range validationFlags {
+			if _, ok := flags[flag]; ok {
+				return nil, failf(`cannot use "%s" flag with a struct option, add it to the fields of the struct instead`, flag)
+			}
+		}
+		structFields, structEnvFields, structFlagFields, err := parseStructFields(fset, resolver, t)
+		if err != nil {
+			return nil, err
+		}
+		fields = structFields
+		envFields = append(envFields, structEnvFields...)
+		flagFields = append(flagFields, structFlagFields...)
+	case *ast.ArrayType:
+		if strings.HasSuffix(publicName, "...") {
+			publicName = publicName[0 : len(publicName)-3]
+			paramType = "..." + getType(fset, t.Elt)
+		}
+		_, isAppend := flags["append"]
+		if isAppend && defaultIsNil {
+			return nil, failf(`cannot use "append" flag with a pointer value`)
+		}
+		validations, err := parseValidations(fset, resolver, valueType, "o.o", lengthOf("o", isAppend), "", flags)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, fieldSpec{Name: "", ParamName: "o", ParamType: paramType, Type: typeStr, Append: isAppend,
+			Clone: clonePackage(resolver, valueType), CheckLength: isAppend && checksLength(flags), Validations: validations})
+	default:
+		if _, isAppend := flags["append"]; isAppend {
+			return nil, failf(`expected a slice type for "append" flag but got %s`, typeStr)
+		}
+		validations, err := parseValidations(fset, resolver, valueType, "o.o", lengthOf("o", false), "", flags)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, fieldSpec{Name: "", ParamName: "o", ParamType: paramType, Type: typeStr,
+			Clone: clonePackage(resolver, valueType), Validations: validations})
+	}
+
+	if defaultIsNil && defaultValue != "" {
+		return nil, failf(`cannot use a pointer value with a default value, use the "default" tag instead`)
+	}
+	literal, ok, err := parseDefaultTag(fset, resolver, field)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if defaultValue != "" {
+			return nil, failf(`cannot use both "options" and "default" tags to set the default value`)
+		}
+		defaultValue = literal
+	}
+	if err := checkDefault(fset, resolver, field, defaultValue); err != nil {
+		return nil, err
+	}
+	_, isAppend := flags["append"]
+	if err := checkDefaultValidations(fset, resolver, field, defaultValue, isAppend, flags); err != nil {
+		return nil, err
+	}
+	flagDefaultValue := defaultValue
+	if defaultIsNil {
+		flagDefaultValue = ""
+	}
+	for i, f := range flagFields {
+		if f.Field == "" && !f.IsSlice {
+			flagFields[i].Default = flagDefault(f.valueParser, flagDefaultValue)
+		}
+	}
+
+	_, isRequired := flags["required"]
+
+	var entryFields []fieldSpec
+	if _, ok := flags["map"]; ok {
+		mapType, isMap := fieldType.(*ast.MapType)
+		if !isMap || defaultIsNil {
+			return nil, failf(`expected a map type for "map" flag but got %s`, typeStr)
+		}
+		entryFields = []fieldSpec{
+			{Name: "", ParamName: "key", ParamType: getType(fset, mapType.Key), Type: getType(fset, mapType.Key)},
+			{Name: "", ParamName: "value", ParamType: getType(fset, mapType.Value), Type: getType(fset, mapType.Value)},
+		}
+	}
+	exclusive, err := splitFlag(flags, "exclusive")
+	if err != nil {
+		return nil, err
+	}
+	requires, err := splitFlag(flags, "requires")
+	if err != nil {
+		return nil, err
+	}
+
+	var options []optionSpec
+	for _, n := range field.Names {
+		options = append(options, optionSpec{
+			Name:         path + n.Name,
+			PublicName:   joinName(namePrefix, stringsOr(publicName, n.Name)),
+			DefaultValue: defaultValue,
+			Fields:       fields,
+			Docs:         docs,
+			DefaultIsNil: defaultIsNil,
+			IsStruct:     isStruct,
+			Required:     isRequired,
+			Exclusive:    exclusive,
+			Requires:     requires,
+			EnvFields:    envFields,
+			FlagFields:   flagFieldsFor(flagFields, joinName(namePrefix, stringsOr(publicName, n.Name))),
+			CanMarshal:   canMarshal(resolver, fieldType),
+			Type:         typeStr,
+			field:        field,
+		})
+		if entryFields != nil {
+			options = append(options, optionSpec{
+				Name:       path + n.Name,
+				PublicName: joinName(namePrefix, stringsOr(publicName, n.Name)) + "Entry",
+				Fields:     entryFields,
+				IsMapEntry: true,
+				CanMarshal: canMarshal(resolver, fieldType),
+				Type:       typeStr,
+				field:      field,
+			})
+		}
+	}
+	return options, nil
+}
+
+// parseStructFields returns the parameters of a struct option and the environment variables and flags of its fields.
+// Failures that don't concern a particular field are attributed to the field of the struct being parsed.
+func parseStructFields(fset *token.FileSet, resolver structResolver, st *ast.StructType) (fields []fieldSpec, envFields []envField, flagFields []flagField, err error) {
+	for _, sfield := range st.Fields.List {
+		paramName, defaultValue, sflags, skip, err := parseStructTag(resolver, sfield)
+		if err != nil {
+			return nil, nil, nil, atField(sfield, err)
+		}
+		if skip {
+			continue
+		}
+		literal, ok, err := parseDefaultTag(fset, resolver, sfield)
+		if err != nil {
+			return nil, nil, nil, atField(sfield, err)
+		}
+		if ok {
+			if defaultValue != "" {
+				return nil, nil, nil, atField(sfield, failf(`cannot use both "options" and "default" tags to set the default value`))
+			}
+			defaultValue = literal
+		}
+		if err := checkDefault(fset, resolver, sfield, defaultValue); err != nil {
+			return nil, nil, nil, atField(sfield, err)
+		}
+		_, isAppend := sflags["append"]
+		if err := checkDefaultValidations(fset, resolver, sfield, defaultValue, isAppend, sflags); err != nil {
+			return nil, nil, nil, atField(sfield, err)
+		}
+		typeStr := getType(fset, sfield.Type)
+		paramType := typeStr
+		if strings.HasSuffix(paramName, "...") {
+			paramName = paramName[0 : len(paramName)-3]
+			t, isSlice := sfield.Type.(*ast.ArrayType)
+			if !isSlice {
+				return nil, nil, nil, atField(sfield, failf(`expected a slice type for variadic parameter "%s..."`, paramName))
+			}
+			paramType = "..." + getType(fset, t.Elt)
+		}
+		if _, isSlice := sfield.Type.(*ast.ArrayType); isAppend && !isSlice {
+			return nil, nil, nil, atField(sfield, failf(`expected a slice type for "append" flag but got %s`, typeStr))
+		}
+		for _, n := range sfield.Names {
+			env, ok, err := parseEnvTag(fset, sfield, sfield.Type)
+			if err != nil {
+				return nil, nil, nil, atField(sfield, err)
+			}
+			if ok {
+				env.Field = n.Name
+				envFields = append(envFields, env)
+			}
+			f, ok, err := parseFlagTag(fset, sfield, sfield.Type, fieldDocs(sfield))
+			if err != nil {
+				return nil, nil, nil, atField(sfield, err)
+			}
+			if ok {
+				f.Field = n.Name
+				f.Var = stringsOr(paramName, n.Name)
+				if !f.IsSlice {
+					f.Default = flagDefault(f.valueParser, defaultValue)
+				}
+				flagFields = append(flagFields, f)
+			}
+			validations, err := parseValidations(fset, resolver, sfield.Type, "o."+stringsOr(paramName, n.Name),
+				lengthOf(stringsOr(paramName, n.Name), isAppend), n.Name+" ", sflags)
+			if err != nil {
+				return nil, nil, nil, atField(sfield, err)
+			}
+			fields = append(fields, fieldSpec{
+				Name:         n.Name,
+				ParamName:    stringsOr(paramName, n.Name),
+				ParamType:    paramType,
+				Type:         typeStr,
+				DefaultValue: defaultValue,
+				Append:       isAppend,
+				Clone:        clonePackage(resolver, sfield.Type),
+				CheckLength:  isAppend && checksLength(sflags),
+				Validations:  validations,
+			})
+		}
+	}
+	return fields, envFields, flagFields, nil
+}
+
+// parseEmbeddedOptions returns the options for the fields promoted from an embedded struct.
+// Embedded types that are not structs are ignored, and embedded pointers to structs are reported because their fields
+// cannot be set without allocating the struct.
+func parseEmbeddedOptions(fset *token.FileSet, resolver structResolver, fieldType ast.Expr, path string, namePrefix string) ([]optionSpec, error) {
+	var name string
+	switch t := fieldType.(type) {
+	case *ast.Ident:
+		name = t.Name
+		if st, ok := resolver.structs[name]; ok {
+			return parseOptions(fset, resolver, st.Fields.List, path+name+".", namePrefix)
+		}
+	case *ast.SelectorExpr:
+		name = t.Sel.Name
+	case *ast.IndexExpr:
+		name = getType(fset, t.X)
+	case *ast.IndexListExpr:
+		name = getType(fset, t.X)
+	case *ast.StarExpr:
+		_, isLocal := resolver.structs[getType(fset, t.X)]
+		if isLocal || resolver.typesInfo != nil && isStruct(resolver.typesInfo.TypeOf(t.X)) {
+			return nil, failf(`cannot promote the fields of embedded pointer %s, embed the struct instead or skip it with options:"-"`,
+				getType(fset, t.X))
+		}
+		return nil, nil
+	default:
+		return nil, nil
+	}
+	if resolver.typesInfo == nil {
+		return nil, nil
+	}
+	fieldTypes := resolver.typesInfo.TypeOf(fieldType)
+	if fieldTypes == nil {
+		return nil, nil
+	}
+	st, ok := fieldTypes.Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return parseTypesOptions(fset, resolver, st, path+name+".", namePrefix)
+}
+
+// parseTypesOptions creates options for a struct known only through go/types, such as one declared in another package.
+// Each field is converted back into an *ast.Field so that it is handled the same way as fields in the source.
+func parseTypesOptions(fset *token.FileSet, resolver structResolver, st *types.Struct, path string, namePrefix string) ([]optionSpec, error) {
+	var options []optionSpec
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		if !v.Exported() && v.Pkg() != resolver.pkg {
+			continue
+		}
+		tag := &ast.BasicLit{Kind: token.STRING, Value: "`" + st.Tag(i) + "`"}
+		if v.Embedded() {
+			publicName, defaultValue, _, skip, err := parseStructTag(resolver, &ast.Field{Tag: tag, Type: ast.NewIdent(v.Name())})
+			if err != nil {
+				return nil, err
+			}
+			if skip {
+				continue
+			}
+			if defaultValue != "" {
+				return nil, failf(`cannot use a default value for embedded field %s`, v.Name())
+			}
+			if ptr, ok := v.Type().(*types.Pointer); ok && isStruct(ptr.Elem()) {
+				return nil, failf(`cannot promote the fields of embedded pointer %s, embed the struct instead or skip it with options:"-"`, v.Name())
+			}
+			if embedded, ok := v.Type().Underlying().(*types.Struct); ok {
+				embeddedOptions, err := parseTypesOptions(fset, resolver, embedded, path+v.Name()+".", joinName(namePrefix, publicName))
+				if err != nil {
+					return nil, err
+				}
+				options = append(options, embeddedOptions...)
+			}
+			continue
+		}
+		var imports []string
+		typeStr := types.TypeString(v.Type(), func(p *types.Package) string {
+			if p == resolver.pkg {
+				return ""
+			}
+			if !slices.Contains(imports, p.Path()) {
+				imports = append(imports, p.Path())
+			}
+			return p.Name()
+		})
+		fieldType, err := parser.ParseExprFrom(fset, "", typeStr, 0)
+		if err != nil {
+			return nil, failf("unable to parse type %q of field %s: %s", typeStr, v.Name(), err)
+		}
+		field := &ast.Field{Names: []*ast.Ident{ast.NewIdent(v.Name())}, Type: fieldType, Tag: tag}
+		fieldOptions, err := parseOptions(fset, resolver, []*ast.Field{field}, path, namePrefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range fieldOptions {
+			o.imports = imports
+			options = append(options, o)
+		}
+	}
+	return options, nil
+}
+
+// isStruct reports whether t is a struct type
+func isStruct(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
+
+// tagFlags are the flags that may follow the default value in a struct tag (e.g. `options:"name,,map"`)
+var tagFlags = map[string]bool{
+	"append":   true,
+	"expr":     true,
+	"map":      true,
+	"required": true,
+	"size":     true,
+
+	// flags relating options to each other
+	"exclusive": true,
+	"requires":  true,
+
+	// validation flags
+	"min":     true,
+	"max":     true,
+	"minlen":  true,
+	"maxlen":  true,
+	"nonzero": true,
+	"oneof":   true,
+	"regexp":  true,
+}
+
+// validationFlags are the flags of tagFlags that check the values given to options
+var validationFlags = []string{"nonzero", "min", "max", "minlen", "maxlen", "oneof", "regexp"}
+
+// parseEnvTag returns how to read a field from the environment if it has an "env" tag
+func parseEnvTag(fset *token.FileSet, field *ast.Field, fieldType ast.Expr) (envField, bool, error) {
+	if field.Tag == nil {
+		return envField{}, false, nil
+	}
+	tags, err := structtag.Parse(field.Tag.Value[1 : len(field.Tag.Value)-1])
+	if err != nil {
+		return envField{}, false, nil
+	}
+	tag, err := tags.Get("env")
+	if err != nil || tag.Name == "" || tag.Name == "-" {
+		return envField{}, false, nil
+	}
+	env := envField{Name: tag.Name, Separator: ","}
+	for _, o := range tag.Options {
+		name, value, _ := strings.Cut(o, "=")
+		if name != "sep" || value == "" {
+			return envField{}, false, failf(`unknown option "%s" in "env" tag`, o)
+		}
+		env.Separator = value
+	}
+	parser, ok := parseValueType(fset, fieldType)
+	if !ok {
+		return envField{}, false, failf(`unsupported type %s for "env" tag`, getType(fset, fieldType))
+	}
+	env.valueParser = parser
+	return env, true, nil
+}
+
+// parseValueType returns how to parse strings into values of fieldType, which is supported if it is a string, bool,
+// number or duration, or a slice of them
+func parseValueType(fset *token.FileSet, fieldType ast.Expr) (valueParser, bool) {
+	var parser valueParser
+	if t, ok := fieldType.(*ast.ArrayType); ok && t.Len == nil {
+		parser.IsSlice = true
+		fieldType = t.Elt
+	}
+	parser.Convert = getType(fset, fieldType)
+	switch t := fieldType.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			parser.FlagFunc, parser.FlagType = "String", "string"
+		case "bool":
+			parser.Parse = "strconv.ParseBool(%s)"
+			parser.FlagFunc, parser.FlagType = "Bool", "bool"
+		case "int", "int8", "int16", "int32", "int64":
+			parser.Parse = fmt.Sprintf("strconv.ParseInt(%%s, 10, %d)", bitSize(t.Name, "int"))
+			parser.FlagFunc, parser.FlagType = "Int64", "int64"
+			switch t.Name {
+			case "int":
+				parser.FlagFunc, parser.FlagType = "Int", "int"
+			case "int8", "int16", "int32":
+				parser.FlagRange = fmt.Sprintf("%%[1]s < math.Min%[1]s || %%[1]s > math.Max%[1]s", toPublic(t.Name))
+			}
+		case "uint", "uint8", "uint16", "uint32", "uint64":
+			parser.Parse = fmt.Sprintf("strconv.ParseUint(%%s, 10, %d)", bitSize(t.Name, "uint"))
+			parser.FlagFunc, parser.FlagType = "Uint64", "uint64"
+			switch t.Name {
+			case "uint":
+				parser.FlagFunc, parser.FlagType = "Uint", "uint"
+			case "uint8", "uint16", "uint32":
+				parser.FlagRange = fmt.Sprintf("%%s > math.Max%s", toPublic(t.Name))
+			}
+		case "float32", "float64":
+			parser.Parse = fmt.Sprintf("strconv.ParseFloat(%%s, %d)", bitSize(t.Name, "float"))
+			parser.FlagFunc, parser.FlagType = "Float64", "float64"
+		default:
+			return parser, false
+		}
+	case *ast.SelectorExpr:
+		pkg, ok := t.X.(*ast.Ident)
+		if !ok || t.Sel.Name != "Duration" {
+			return parser, false
+		}
+		parser.Parse = pkg.Name + ".ParseDuration(%s)"
+		parser.FlagFunc, parser.FlagType = "Duration", parser.Convert
+	default:
+		return parser, false
+	}
+	return parser, true
+}
+
+// bitSize returns the size of a numeric type such as "int32" for use with strconv, or 64 for "int"
+func bitSize(typeName string, kind string) int {
+	if size, err := strconv.Atoi(strings.TrimPrefix(typeName, kind)); err == nil {
+		return size
+	}
+	return 64
+}
+
+// canMarshal reports whether values of a type can round-trip through JSON, which is not the case for functions,
+// channels and interfaces.  The fields of inline structs are checked because options take them as arguments.
+func canMarshal(resolver structResolver, expr ast.Expr) bool {
+	if t, ok := expr.(*ast.StructType); ok {
+		for _, f := range t.Fields.List {
+			if !canMarshal(resolver, f.Type) {
+				return false
+			}
+		}
+		return true
+	}
+	if resolver.typesInfo != nil {
+		if t := resolver.typesInfo.TypeOf(expr); t != nil {
+			return canMarshalType(t, make(map[types.Type]bool))
+		}
+	}
+	switch t := expr.(type) {
+	case *ast.FuncType, *ast.ChanType, *ast.InterfaceType:
+		return false
+	case *ast.Ident:
+		return t.Name != "any" && t.Name != "error"
+	case *ast.StarExpr:
+		return canMarshal(resolver, t.X)
+	case *ast.ArrayType:
+		return canMarshal(resolver, t.Elt)
+	case *ast.MapType:
+		return canMarshal(resolver, t.Key) && canMarshal(resolver, t.Value)
+	}
+	return true
+}
+
+// canMarshalType reports whether values of a type can round-trip through JSON.  Named types that implement
+// json.Marshaler are assumed to round-trip, and only the exported fields of named structs are checked.  Structs with
+// fields that are all unexported cannot round-trip because JSON leaves the fields out.
+func canMarshalType(t types.Type, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+	// the constraint of a type parameter is an interface, but its values have the type that it is instantiated with,
+	// so marshaling is left to that type
+	if _, ok := t.(*types.TypeParam); ok {
+		return true
+	}
+	if named, ok := t.(*types.Named); ok {
+		if sel := types.NewMethodSet(types.NewPointer(named)).Lookup(nil, "MarshalJSON"); sel != nil {
+			return true
+		}
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Signature, *types.Chan, *types.Interface:
+		return false
+	case *types.Pointer:
+		return canMarshalType(u.Elem(), seen)
+	case *types.Slice:
+		return canMarshalType(u.Elem(), seen)
+	case *types.Array:
+		return canMarshalType(u.Elem(), seen)
+	case *types.Map:
+		return canMarshalType(u.Key(), seen) && canMarshalType(u.Elem(), seen)
+	case *types.Struct:
+		_, isNamed := t.(*types.Named)
+		encoded := 0
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if f.Exported() || f.Embedded() {
+				encoded++
+			}
+			if (f.Exported() || !isNamed) && !canMarshalType(f.Type(), seen) {
+				return false
+			}
+		}
+		return u.NumFields() == 0 || encoded > 0
+	}
+	return true
+}
+
+// fieldDocs returns the doc comment and line comment of a field
+func fieldDocs(field *ast.Field) []string {
+	var docs []string
+	if field.Doc != nil {
+		docs = append(docs, field.Doc.Text())
+	}
+	if field.Comment != nil {
+		docs = append(docs, field.Comment.Text())
+	}
+	return docs
+}
+
+// parseFlagTag returns how to define a command-line flag for a field.  Fields get flags if their type is supported,
+// unless they have a "flag" tag of "-", and the tag may also set the name of the flag.
+func parseFlagTag(fset *token.FileSet, field *ast.Field, fieldType ast.Expr, docs []string) (flagField, bool, error) {
+	var name string
+	if field.Tag != nil {
+		if tags, err := structtag.Parse(field.Tag.Value[1 : len(field.Tag.Value)-1]); err == nil {
+			if tag, err := tags.Get("flag"); err == nil {
+				name = tag.Name
+			}
+		}
+	}
+	if name == "-" {
+		return flagField{}, false, nil
+	}
+	parser, ok := parseValueType(fset, fieldType)
+	if !ok {
+		if name != "" {
+			return flagField{}, false, failf(`unsupported type %s for "flag" tag`, getType(fset, fieldType))
+		}
+		return flagField{}, false, nil
+	}
+	return flagField{valueParser: parser, Name: name, Usage: strings.Join(strings.Fields(strings.Join(docs, " ")), " ")}, true, nil
+}
+
+// flagDefault returns the default value of a flag for a single value, converting the default value of the field to
+// the type of the flag
+func flagDefault(parser valueParser, defaultValue string) string {
+	switch {
+	case defaultValue == "" && parser.FlagFunc == "String":
+		return `""`
+	case defaultValue == "" && parser.FlagFunc == "Bool":
+		return "false"
+	case defaultValue == "":
+		return "0"
+	case parser.FlagType != parser.Convert:
+		return fmt.Sprintf("%s(%s)", parser.FlagType, defaultValue)
+	}
+	return defaultValue
+}
+
+// flagFieldsFor returns a copy of the flags of an option, naming them after the public name of the option and the
+// fields of struct options
+func flagFieldsFor(flagFields []flagField, publicName string) []flagField {
+	publicName = strings.TrimSuffix(publicName, "...")
+	var result []flagField
+	for _, f := range flagFields {
+		if f.Field != "" {
+			f.Name = stringsOr(f.Name, toKebab(publicName)+"-"+toKebab(f.Var))
+			f.Var = toPrivate(publicName) + toPublic(f.Var) + "Value"
+		} else {
+			f.Name = stringsOr(f.Name, toKebab(publicName))
+			f.Var = toPrivate(publicName) + "Value"
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// toKebab converts a name such as "myHTTPPort" into a flag name such as "my-http-port"
+func toKebab(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// splitFlag returns the values of a flag separated by "|" or nil if the flag is not set
+func splitFlag(flags map[string]string, name string) ([]string, error) {
+	value, ok := flags[name]
+	if !ok {
+		return nil, nil
+	}
+	if value == "" {
+		return nil, failf(`expected a value for "%s" flag`, name)
+	}
+	return strings.Split(value, "|"), nil
+}
+
+// parseValidations creates the checks requested by the validation flags in a struct tag.
+// value is the expression holding the value in the generated apply method, length is the expression for its length and
+// label is prepended to each message.
+func parseValidations(fset *token.FileSet, resolver structResolver, fieldType ast.Expr, value string, length string, label string, flags map[string]string) ([]validation, error) {
+	var validations []validation
+	add := func(check string, message string) {
+		validations = append(validations, validation{Check: check, Message: label + message})
+	}
+	for _, flag := range []string{"min", "max", "minlen", "maxlen"} {
+		if n, ok := flags[flag]; ok {
+			if _, err := strconv.ParseFloat(n, 64); err != nil {
+				return nil, failf(`expected a number for "%s" flag but got "%s"`, flag, n)
+			}
+		}
+	}
+	if _, ok := flags["nonzero"]; ok {
+		switch fieldType.(type) {
+		case *ast.ArrayType, *ast.MapType:
+			add(fmt.Sprintf("%s == 0", length), "must not be empty")
+		case *ast.StarExpr, *ast.FuncType, *ast.InterfaceType, *ast.ChanType:
+			add(fmt.Sprintf("%s == nil", value), "must not be nil")
+		default:
+			add(fmt.Sprintf("%s == *new(%s)", value, getType(fset, fieldType)), "must not be zero")
+		}
+	}
+	if n, ok := flags["min"]; ok {
+		add(fmt.Sprintf("%s < %s", value, n), "must be >= "+n)
+	}
+	if n, ok := flags["max"]; ok {
+		add(fmt.Sprintf("%s > %s", value, n), "must be <= "+n)
+	}
+	if n, ok := flags["minlen"]; ok {
+		add(fmt.Sprintf("%s < %s", length, n), "length must be >= "+n)
+	}
+	if n, ok := flags["maxlen"]; ok {
+		add(fmt.Sprintf("%s > %s", length, n), "length must be <= "+n)
+	}
+	if values, ok := flags["oneof"]; ok {
+		var checks []string
+		for _, v := range strings.Split(values, "|") {
+			if isStringType(resolver, fieldType) {
+				v = strconv.Quote(v)
+			}
+			checks = append(checks, fmt.Sprintf("%s != %s", value, v))
+		}
+		add(strings.Join(checks, " && "), "must be one of "+strings.ReplaceAll(values, "|", ", "))
+	}
+	if pattern, ok := flags["regexp"]; ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, failf(`invalid "regexp" flag: %s`, err)
+		}
+		add(fmt.Sprintf("!%s.MatchString(%s)", resolver.patternVar(pattern), value), "must match "+pattern)
+	}
+	return validations, nil
+}
+
+// lengthOf returns the expression for the length of a value given to an option in the generated apply method.  The
+// length of an "append" field includes the values already in the config, which the apply method holds in the variable
+// named by appendedLength.
+func lengthOf(paramName string, isAppend bool) string {
+	if isAppend {
+		return appendedLength(paramName)
+	}
+	return fmt.Sprintf("len(o.%s)", paramName)
+}
+
+// checksLength reports whether the flags of a field include validations that check its length
+func checksLength(flags map[string]string) bool {
+	for _, flag := range []string{"nonzero", "minlen", "maxlen"} {
+		if _, ok := flags[flag]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// appendedLength returns the name of the variable holding the length of an "append" field after the values given to
+// its option are appended
+func appendedLength(paramName string) string {
+	if paramName == "o" {
+		return "length"
+	}
+	return paramName + "Length"
+}
+
+// patternVar returns the name of the variable holding a compiled regular expression, adding it to the patterns of the
+// type being generated if no other option uses the same expression
+func (r structResolver) patternVar(expr string) string {
+	expr = strconv.Quote(expr)
+	for _, p := range r.generated.patterns {
+		if p.Expr == expr {
+			return p.Name
+		}
+	}
+	name := fmt.Sprintf("%sPattern%d", toPrivate(r.diags.typeName), len(r.generated.patterns)+1)
+	r.generated.patterns = append(r.generated.patterns, pattern{Name: name, Expr: expr})
+	return name
+}
+
+// isStringType reports whether the underlying type of a field is a string.  Named types are only recognized when the
+// package was type-checked.
+func isStringType(resolver structResolver, expr ast.Expr) bool {
+	if resolver.typesInfo != nil {
+		if t := resolver.typesInfo.TypeOf(expr); t != nil {
+			basic, ok := t.Underlying().(*types.Basic)
+			return ok && basic.Info()&types.IsString != 0
+		}
+	}
+	t, ok := expr.(*ast.Ident)
+	return ok && t.Name == "string"
+}
+
+// clonePackage returns "maps" or "slices" if the type is a map or a slice, which are copied with the Clone function of
+// that package
+func clonePackage(resolver structResolver, expr ast.Expr) string {
+	if resolver.typesInfo != nil {
+		if t := resolver.typesInfo.TypeOf(expr); t != nil {
+			switch t.Underlying().(type) {
+			case *types.Map:
+				return "maps"
+			case *types.Slice:
+				return "slices"
+			}
+			return ""
+		}
+	}
+	switch t := expr.(type) {
+	case *ast.MapType:
+		return "maps"
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "slices"
+		}
+	}
+	return ""
+}
+
+func parseStructTag(resolver structResolver, field *ast.Field) (publicName string, defaultValue string, flags map[string]string, skip bool, err error) {
+	flags = make(map[string]string)
+	if field.Tag != nil {
+		value := field.Tag.Value
+		tags, err := structtag.Parse(value[1 : len(value)-1])
+		if err == nil {
+			tag, err := tags.Get("options")
+			if err != nil && err.Error() == "tag does not exist" {
+				goto SkipTag
+			} else if err != nil {
+				return "", "", nil, false, failf(`unable to parse "options" tag: %s`, err)
+			}
+			if tag.Name == "-" {
+				return "", "", nil, true, nil
+			}
+			publicName = tag.Name
+			if len(tag.Options) > 0 {
+				defaultValue = tag.Options[0]
+			}
+			for _, f := range tag.Options[min(1, len(tag.Options)):] {
+				name, value, _ := strings.Cut(f, "=")
+				if !tagFlags[name] {
+					return "", "", nil, false, failf(`unknown flag "%s" in "options" tag, format is options:"<name>,<default value>,<flag>..."`, name)
+				}
+				flags[name] = value
+			}
+		}
+	}
+SkipTag:
+	defaultValue, err = formatDefault(resolver, field.Type, defaultValue, flags)
+	return publicName, defaultValue, flags, false, err
+}
+
+// findStructs returns the struct types declared at the top level of files, keyed by name
+func findStructs(files ...*ast.File) map[string]*ast.StructType {
+	structs := make(map[string]*ast.StructType)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if st, ok := typeSpec.Type.(*ast.StructType); ok && typeSpec.TypeParams == nil {
+					structs[typeSpec.Name.Name] = st
+				}
+			}
+		}
+	}
+	return structs
+}
+
+// checkDefault uses go/types to verify that a default value can be assigned to its field, reporting any error at the
+// position of the struct tag so that it points at the input file rather than the generated code
+func checkDefault(fset *token.FileSet, resolver structResolver, field *ast.Field, defaultValue string) error {
+	if !resolver.checkDefaults || defaultValue == "" || field.Tag == nil || !field.Tag.Pos().IsValid() {
+		return nil
+	}
+	fail := func(format string, args ...interface{}) error {
+		return failure{err: fmt.Errorf(format, args...), field: field, pos: field.Tag.Pos()}
+	}
+	if _, err := parser.ParseExpr(defaultValue); err != nil {
+		return fail(`default value %s is not a valid expression`, defaultValue)
+	}
+	expr := fmt.Sprintf("func() { var _ %s = %s }", getType(fset, field.Type), defaultValue)
+	if _, err := types.Eval(fset, resolver.pkg, field.Tag.Pos(), expr); err != nil {
+		msg := err.Error()
+		if typesErr, ok := err.(types.Error); ok {
+			msg = typesErr.Msg
+		}
+		return fail(`invalid default value %s for %s: %s`, defaultValue, getType(fset, field.Type), msg)
+	}
+	return nil
+}
+
+// checkDefaultValidations verifies that a default value passes the validation flags of its field, so that the config
+// cannot start with a value that its options would reject.  Only constants, and the lengths of composite literals, are
+// checked.  Since the values given to an "append" option are added to the default, its default is only checked
+// against "maxlen".
+func checkDefaultValidations(fset *token.FileSet, resolver structResolver, field *ast.Field, defaultValue string, isAppend bool, flags map[string]string) error {
+	if !resolver.checkDefaults || defaultValue == "" || field.Tag == nil || !field.Tag.Pos().IsValid() {
+		return nil
+	}
+	fail := func(message string) error {
+		return failure{err: fmt.Errorf(`invalid default value %s: %s`, defaultValue, message), field: field, pos: field.Tag.Pos()}
+	}
+	typeStr := getType(fset, field.Type)
+	eval := func(expr string) constant.Value {
+		tv, err := types.Eval(fset, resolver.pkg, field.Tag.Pos(), fmt.Sprintf("(%s)(%s)", typeStr, expr))
+		if err != nil {
+			return nil
+		}
+		return tv.Value
+	}
+	value := eval(defaultValue)
+	length := -1
+	if value != nil && value.Kind() == constant.String {
+		length = len(constant.StringVal(value))
+	} else if lit, ok := ast.Unparen(parseExpr(defaultValue)).(*ast.CompositeLit); ok {
+		length = len(lit.Elts)
+	}
+	isNumber := func(v constant.Value) bool {
+		return v != nil && (v.Kind() == constant.Int || v.Kind() == constant.Float)
+	}
+	// compare reports whether x op y holds, or false if the values cannot be compared
+	compare := func(x constant.Value, op token.Token, y constant.Value) bool {
+		if x == nil || y == nil || x.Kind() != y.Kind() && !(isNumber(x) && isNumber(y)) {
+			return false
+		}
+		return constant.Compare(x, op, y)
+	}
+	// bound returns the number given to a flag, which is reported by parseValidations if it is invalid
+	bound := func(flag string) constant.Value {
+		n, err := strconv.ParseFloat(flags[flag], 64)
+		if err != nil {
+			return nil
+		}
+		return constant.MakeFloat64(n)
+	}
+	var lengthValue constant.Value
+	if length >= 0 {
+		lengthValue = constant.MakeInt64(int64(length))
+	}
+
+	if _, ok := flags["nonzero"]; ok && !isAppend {
+		switch {
+		case value != nil && value.Kind() == constant.Bool && !constant.BoolVal(value),
+			value != nil && value.Kind() == constant.String && constant.StringVal(value) == "",
+			isNumber(value) && constant.Sign(value) == 0:
+			return fail("must not be zero")
+		case value == nil && length == 0:
+			return fail("must not be empty")
+		}
+	}
+	if n, ok := flags["min"]; ok && isNumber(value) && compare(value, token.LSS, bound("min")) {
+		return fail("must be >= " + n)
+	}
+	if n, ok := flags["max"]; ok && isNumber(value) && compare(value, token.GTR, bound("max")) {
+		return fail("must be <= " + n)
+	}
+	if n, ok := flags["minlen"]; ok && !isAppend && compare(lengthValue, token.LSS, bound("minlen")) {
+		return fail("length must be >= " + n)
+	}
+	if n, ok := flags["maxlen"]; ok && compare(lengthValue, token.GTR, bound("maxlen")) {
+		return fail("length must be <= " + n)
+	}
+	if values, ok := flags["oneof"]; ok && value != nil {
+		found := false
+		for _, v := range strings.Split(values, "|") {
+			if isStringType(resolver, field.Type) {
+				v = strconv.Quote(v)
+			}
+			// values that are not constants are only compared by the generated code
+			if other := eval(v); other == nil || compare(value, token.EQL, other) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("must be one of " + strings.ReplaceAll(values, "|", ", "))
+		}
+	}
+	if pattern, ok := flags["regexp"]; ok && value != nil && value.Kind() == constant.String {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(constant.StringVal(value)) {
+			return fail("must match " + pattern)
+		}
+	}
+	return nil
+}
+
+// parseExpr parses a Go expression, returning nil if it is invalid
+func parseExpr(expr string) ast.Expr {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil
+	}
+	return e
+}
+
+// getType returns a string of the type for a field by looking it up in the original source
+func getType(fset *token.FileSet, fieldType ast.Expr) string {
+	typeBuf := new(bytes.Buffer)
+	// printing an expression to a buffer cannot fail
+	_ = printer.Fprint(typeBuf, fset, fieldType)
+	return typeBuf.String()
+}
+
+// getTypeParams returns the type parameter list for a generic type as it appears in a declaration (e.g. "[T any]")
+// and as it appears when the type is instantiated with its own parameters (e.g. "[T]")
+func getTypeParams(fset *token.FileSet, fieldList *ast.FieldList) (params string, args string) {
+	if fieldList == nil || len(fieldList.List) == 0 {
+		return "", ""
+	}
+	var paramList, argList []string
+	for _, field := range fieldList.List {
+		var names []string
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+		}
+		paramList = append(paramList, fmt.Sprintf("%s %s", strings.Join(names, ", "), getType(fset, field.Type)))
+		argList = append(argList, names...)
+	}
+	return "[" + strings.Join(paramList, ", ") + "]", "[" + strings.Join(argList, ", ") + "]"
+}
+
+// joinName prepends a prefix to a public option name
+func joinName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + toPublic(name)
+}
+
+// return first non-empty string
+func stringsOr(strs ...string) string {
+	for _, s := range strs {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
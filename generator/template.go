@@ -0,0 +1,29 @@
+package generator
+
+import (
+	_ "embed"
+	"strings"
+	"text/template"
+)
+
+//go:embed render.gotmpl
+var codeTemplateText string
+
+// store code generating template in constant
+var codeTemplate = template.Must(template.New("code").Funcs(funcMap).Parse(codeTemplateText))
+
+var funcMap = template.FuncMap{
+	"ToPrivate": toPrivate,
+	"ToPublic":  toPublic,
+	"HasPrefix": strings.HasPrefix,
+
+	"AppendedLength": appendedLength,
+}
+
+func toPrivate(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func toPublic(s string) string {
+	return strings.ToUpper(s[:1]) + s[1:]
+}
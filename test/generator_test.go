@@ -0,0 +1,315 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/launchdarkly/go-options/generator"
+)
+
+var _ = Describe("Generator API", func() {
+	It("generates the same file as the command", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"config"}
+		cfg.Imports = "time,net/url,time2=time"
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Name).Should(Equal("config_options.go"))
+
+		golden, err := os.ReadFile("golden/config_options.go.txt")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(files[0].Content)).Should(Equal(string(golden)))
+	})
+
+	It("names files relative to the directory of the package", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"Remote"}
+		cfg.Dir = "shared"
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Name).Should(Equal("shared/Remote_options.go"))
+	})
+
+	It("returns errors instead of exiting", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithValidation"}
+		cfg.ReturnError = false
+		_, err := generator.Generate(context.Background(), cfg)
+		Ω(err).Should(MatchError(ContainSubstring("cannot be used with -noerror=false")))
+
+		cfg = generator.DefaultConfig()
+		cfg.TypeNames = []string{"config"}
+		cfg.OptionPrefix = "Opt"
+		cfg.OptionSuffix = "Option"
+		_, err = generator.Generate(context.Background(), cfg)
+		Ω(err).Should(MatchError("cannot specify both -prefix and -suffix options"))
+	})
+
+	It("generates the marked types of every package matching a pattern in one load", func() {
+		cfg := generator.DefaultConfig()
+		cfg.Patterns = []string{"./..."}
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(files).Should(HaveLen(2))
+		Ω(files[0].Name).Should(Equal("configWithMarker_options.go"))
+		Ω(files[0].Compare()).Should(BeEmpty())
+		Ω(files[1].Name).Should(Equal(filepath.Join("shared", "Endpoint_options.go")))
+		Ω(string(files[1].Content)).Should(ContainSubstring("func NewEndpoint(options ...EndpointOption) (Endpoint, error)"))
+		Ω(string(files[1].Content)).Should(ContainSubstring("func EndpointOptionPort(o int) EndpointOption"))
+
+		cfg.TypeNames = []string{"Remote", "missing"}
+		_, err = generator.Generate(context.Background(), cfg)
+		Ω(err).Should(MatchError(`unable to find type "missing"`))
+
+		cfg = generator.DefaultConfig()
+		cfg.Patterns = []string{"./invalid"}
+		_, err = generator.Generate(context.Background(), cfg)
+		Ω(err).Should(MatchError("no types marked with //options:generate were found in ./invalid"))
+	})
+
+	It("reports directives that cannot be applied", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithUnknownSetting", "configWithMissingValue"}
+		cfg.Dir = "invalid"
+		_, err := generator.Generate(context.Background(), cfg)
+		var diags generator.Diagnostics
+		Ω(errors.As(err, &diags)).Should(BeTrue())
+		for i := range diags {
+			diags[i].File = ""
+		}
+		Ω(diags).Should(Equal(generator.Diagnostics{
+			{Line: 25, Column: 1, Type: "configWithUnknownSetting", Message: `unknown setting "bogus" in //options: directive`},
+			{Line: 33, Column: 1, Type: "configWithMissingValue", Message: `setting "prefix" in //options: directive requires a value`},
+		}))
+	})
+
+	It("reports embedded fields that cannot be promoted", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithBadEmbedding"}
+		cfg.Dir = "invalid"
+		_, err := generator.Generate(context.Background(), cfg)
+		var diags generator.Diagnostics
+		Ω(errors.As(err, &diags)).Should(BeTrue())
+		for i := range diags {
+			diags[i].File = ""
+		}
+		Ω(diags).Should(Equal(generator.Diagnostics{
+			{Line: 43, Column: 2, Type: "configWithBadEmbedding", Field: "*embeddedConfig",
+				Message: `cannot promote the fields of embedded pointer embeddedConfig, embed the struct instead or skip it with options:"-"`},
+			{Line: 45, Column: 2, Type: "configWithBadEmbedding", Field: "myInt",
+				Message: `option "OptionMyInt" is also created for field embeddedConfig2.myInt`},
+		}))
+	})
+
+	It("reports default values that don't match the type of the field at their tags", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithMistypedDefaults"}
+		cfg.Dir = "invalid"
+		_, err := generator.Generate(context.Background(), cfg)
+		var diags generator.Diagnostics
+		Ω(errors.As(err, &diags)).Should(BeTrue())
+		for i := range diags {
+			Ω(diags[i].File).Should(HaveSuffix("invalid.go"))
+			diags[i].File = ""
+		}
+		Ω(diags).Should(Equal(generator.Diagnostics{
+			{Line: 53, Column: 14, Type: "configWithMistypedDefaults", Field: "version", Tag: `options:",1.2.3"`,
+				Message: `default value 1.2.3 is not a valid expression`},
+			{Line: 54, Column: 14, Type: "configWithMistypedDefaults", Field: "count", Tag: `options:",\"seven\""`,
+				Message: `invalid default value "seven" for int: cannot use "seven" (untyped string constant) as int value in variable declaration`},
+		}))
+	})
+
+	It("reports types generated into the same file", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"validConfig", "embeddedConfig"}
+		cfg.Dir = "invalid"
+		cfg.OutputName = "shared_options.go"
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Name).Should(Equal(filepath.Join("invalid", "shared_options.go")))
+
+		var diags generator.Diagnostics
+		Ω(errors.As(err, &diags)).Should(BeTrue())
+		Ω(diags).Should(HaveLen(1))
+		Ω(diags[0].File).Should(HaveSuffix("invalid.go"))
+		diags[0].File = ""
+		Ω(diags[0]).Should(Equal(generator.Diagnostic{Line: 38, Column: 6, Type: "embeddedConfig",
+			Message: "output file invalid/shared_options.go is also generated for type validConfig, use -output to choose another name"}))
+	})
+
+	It("reports validation flags on struct options", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithStructValidation"}
+		cfg.Dir = "invalid"
+		_, err := generator.Generate(context.Background(), cfg)
+		Ω(err).Should(MatchError(HaveSuffix(
+			"invalid.go:62:2: configWithStructValidation.inner: cannot use \"min\" flag with a struct option, add it to the fields of the struct instead (tag `options:\",,min=1\"`)")))
+	})
+
+	It("reports missing types along with the problems and files of the types that were found", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"validConfig", "configWithStructValidation", "missing"}
+		cfg.Dir = "invalid"
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Name).Should(Equal(filepath.Join("invalid", "validConfig_options.go")))
+
+		var diags generator.Diagnostics
+		Ω(errors.As(err, &diags)).Should(BeTrue())
+		Ω(diags).Should(HaveLen(2))
+		Ω(diags[0]).Should(Equal(generator.Diagnostic{Message: `unable to find type "missing"`}))
+		Ω(diags[1].Type).Should(Equal("configWithStructValidation"))
+	})
+
+	It("reports default values that their validation flags reject", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithInvalidDefaults"}
+		cfg.Dir = "invalid"
+		_, err := generator.Generate(context.Background(), cfg)
+		var diags generator.Diagnostics
+		Ω(errors.As(err, &diags)).Should(BeTrue())
+		for i := range diags {
+			Ω(diags[i].File).Should(HaveSuffix("invalid.go"))
+			diags[i].File = ""
+		}
+		Ω(diags).Should(Equal(generator.Diagnostics{
+			{Line: 68, Column: 17, Type: "configWithInvalidDefaults", Field: "count", Tag: `options:",50,max=10"`,
+				Message: `invalid default value 50: must be <= 10`},
+			{Line: 69, Column: 17, Type: "configWithInvalidDefaults", Field: "level", Tag: `options:",debug,oneof=info|warn"`,
+				Message: "invalid default value `debug`: must be one of info, warn"},
+			{Line: 70, Column: 17, Type: "configWithInvalidDefaults", Field: "tags",
+				Tag:     `default:"[\"a\", \"b\", \"c\"]" options:",,maxlen=2"`,
+				Message: `invalid default value []string{"a", "b", "c"}: length must be <= 2`},
+		}))
+	})
+
+	It("reports default values that are neither JSON nor Go expressions", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithBrokenDefault"}
+		cfg.Dir = "invalid"
+		_, err := generator.Generate(context.Background(), cfg)
+		Ω(err).Should(MatchError(HaveSuffix(
+			"invalid.go:58:2: configWithBrokenDefault.values: default value [1, 2 is neither JSON nor a Go expression (tag `default:\"[1, 2\"`)")))
+	})
+
+	It("imports yaml.v3 only when decoding YAML", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithDocuments"}
+		cfg.DecodeDocuments = true
+		cfg.DecodeYAML = false
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(files[0].Content)).Should(ContainSubstring("func OptionsFromJSON("))
+		Ω(string(files[0].Content)).ShouldNot(ContainSubstring("FromYAML"))
+		Ω(string(files[0].Content)).ShouldNot(ContainSubstring("gopkg.in/yaml.v3"))
+	})
+
+	It("compares generated files with the files on disk", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"config"}
+		cfg.Imports = "time,net/url,time2=time"
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(files[0].Compare()).Should(BeEmpty())
+
+		dir, err := os.MkdirTemp("", "go-options")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "config_options.go")
+		Ω(os.WriteFile(name, []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn"), 0644)).Should(Succeed())
+
+		file := generator.GeneratedFile{Name: name, Content: []byte("a\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nN\n")}
+		Ω(file.Compare()).Should(Equal("--- " + name + "\n+++ " + name + " (generated)\n" +
+			"@@ -1,5 +1,4 @@\n a\n-b\n c\n d\n e\n" +
+			"@@ -11,4 +10,4 @@\n k\n l\n m\n-n\n\\ No newline at end of file\n+N\n"))
+
+		file.Name = filepath.Join(dir, "missing_options.go")
+		Ω(file.Compare()).Should(HavePrefix("--- " + file.Name + "\n+++ " + file.Name + " (generated)\n@@ -0,0 +1,13 @@\n+a\n"))
+	})
+
+	It("produces the same hunks as diff -u", func() {
+		dir, err := os.MkdirTemp("", "go-options")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "config_options.go")
+		compare := func(existing string, generated string) string {
+			Ω(os.WriteFile(name, []byte(existing), 0644)).Should(Succeed())
+			diff, err := generator.GeneratedFile{Name: name, Content: []byte(generated)}.Compare()
+			Ω(err).ShouldNot(HaveOccurred())
+			return strings.TrimPrefix(diff, "--- "+name+"\n+++ "+name+" (generated)\n")
+		}
+		// lines returns the numbers from 1 to n on separate lines, replacing some of them
+		lines := func(n int, replaced map[int]string) string {
+			var b strings.Builder
+			for i := 1; i <= n; i++ {
+				if r, ok := replaced[i]; ok {
+					b.WriteString(r + "\n")
+				} else {
+					fmt.Fprintf(&b, "%d\n", i)
+				}
+			}
+			return b.String()
+		}
+
+		Ω(compare("", "")).Should(BeEmpty())
+		Ω(compare("a\nb", "a\nb")).Should(BeEmpty())
+
+		Ω(compare("a\nb\nc\nd\ne\n", "a\nb\nc\nd\ne\nf\n")).Should(Equal("@@ -3,3 +3,4 @@\n c\n d\n e\n+f\n"))
+
+		// changes separated by twice the context share a hunk
+		Ω(compare(lines(12, nil), lines(12, map[int]string{2: "X", 9: "Y"}))).Should(Equal(
+			"@@ -1,12 +1,12 @@\n 1\n-2\n+X\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+Y\n 10\n 11\n 12\n"))
+		Ω(compare(lines(13, nil), lines(13, map[int]string{2: "X", 10: "Y"}))).Should(Equal(
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n" +
+				"@@ -7,7 +7,7 @@\n 7\n 8\n 9\n-10\n+Y\n 11\n 12\n 13\n"))
+
+		Ω(compare("a\nb", "a\nc")).Should(Equal(
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"))
+	})
+
+	It("reports every problem with its position, field and tag", func() {
+		cfg := generator.DefaultConfig()
+		cfg.TypeNames = []string{"configWithMistakes", "configWithMoreMistakes", "validConfig"}
+		cfg.Dir = "invalid"
+		cfg.ReturnError = false
+		files, err := generator.Generate(context.Background(), cfg)
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Name).Should(Equal("invalid/validConfig_options.go"))
+
+		Ω(err.Error()).Should(ContainSubstring(
+			"invalid.go:5:2: configWithMistakes.badFlag: unknown flag \"bogus\" in \"options\" tag"))
+
+		var diags generator.Diagnostics
+		Ω(errors.As(err, &diags)).Should(BeTrue())
+		for i := range diags {
+			Ω(diags[i].File).Should(HaveSuffix("invalid.go"))
+			diags[i].File = ""
+		}
+		Ω(diags).Should(Equal(generator.Diagnostics{
+			{Line: 5, Column: 2, Type: "configWithMistakes", Field: "badFlag", Tag: `options:",,bogus"`,
+				Message: `unknown flag "bogus" in "options" tag, format is options:"<name>,<default value>,<flag>..."`},
+			{Line: 6, Column: 2, Type: "configWithMistakes", Field: "badAppend", Tag: `options:",,append"`,
+				Message: `expected a slice type for "append" flag but got string`},
+			{Line: 8, Column: 3, Type: "configWithMistakes", Field: "nested.names", Tag: `options:"names...,"`,
+				Message: `expected a slice type for variadic parameter "names..."`},
+			{Line: 10, Column: 17, Type: "configWithMistakes", Field: "badDefault", Tag: `options:",\"seven\""`,
+				Message: `invalid default value "seven" for int: cannot use "seven" (untyped string constant) as int value in variable declaration`},
+			{Line: 14, Column: 2, Type: "configWithMoreMistakes", Field: "badMin", Tag: `options:",,min=abc"`,
+				Message: `expected a number for "min" flag but got "abc"`},
+			{Line: 15, Column: 2, Type: "configWithMoreMistakes", Field: "lonely", Tag: `options:",,exclusive=solo"`,
+				Message: `exclusive group "solo" only contains option "OptionLonely"`},
+			{Line: 16, Column: 2, Type: "configWithMoreMistakes", Field: "required", Tag: `options:",,required"`,
+				Message: `required options require returning errors and cannot be used with -noerror=false`},
+		}))
+	})
+})
@@ -0,0 +1,71 @@
+// Package invalid declares config types with mistakes in their tags so we can test the diagnostics of the generator
+package invalid
+
+type configWithMistakes struct { // nolint:unused // only read by the generator
+	badFlag   int    `options:",,bogus"`
+	badAppend string `options:",,append"`
+	nested    struct {
+		names string `options:"names...,"`
+	}
+	badDefault int `options:",\"seven\""`
+}
+
+type configWithMoreMistakes struct { // nolint:unused // only read by the generator
+	badMin   int `options:",,min=abc"`
+	lonely   int `options:",,exclusive=solo"`
+	required int `options:",,required"`
+}
+
+type validConfig struct { // nolint:unused // only read by the generator
+	myInt int `options:",1"`
+}
+
+// configWithUnknownSetting has a directive with a setting that isn't a flag
+//
+//options:prefix=Opt bogus
+type configWithUnknownSetting struct { // nolint:unused // only read by the generator
+	myInt int
+}
+
+// configWithMissingValue has a directive without the value of a flag that isn't boolean
+//
+//options:track
+//options:prefix
+type configWithMissingValue struct { // nolint:unused // only read by the generator
+	myInt int
+}
+
+type embeddedConfig struct { // nolint:unused // only read by the generator
+	myInt int
+}
+
+type configWithBadEmbedding struct { // nolint:unused // only read by the generator
+	*embeddedConfig
+	embeddedConfig2
+	myInt int
+}
+
+type embeddedConfig2 struct { // nolint:unused // only read by the generator
+	myInt int
+}
+
+type configWithMistypedDefaults struct { // nolint:unused // only read by the generator
+	version int `options:",1.2.3"`
+	count   int `options:",\"seven\""`
+}
+
+type configWithBrokenDefault struct { // nolint:unused // only read by the generator
+	values []int `default:"[1, 2"`
+}
+
+type configWithStructValidation struct { // nolint:unused // only read by the generator
+	inner struct {
+		n int
+	} `options:",,min=1"`
+}
+
+type configWithInvalidDefaults struct { // nolint:unused // only read by the generator
+	count int      `options:",50,max=10"`
+	level string   `options:",debug,oneof=info|warn"`
+	tags  []string `default:"[\"a\", \"b\", \"c\"]" options:",,maxlen=2"`
+}
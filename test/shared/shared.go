@@ -0,0 +1,19 @@
+// Package shared declares config types in a separate package so we can test promoting their fields
+package shared
+
+import "time"
+
+type Remote struct {
+	RemoteInt     int `options:",3"`
+	RemoteString  string
+	RemoteTimeout time.Duration
+	hidden        int // nolint:structcheck,unused // not expected to be promoted
+}
+
+// Endpoint is only generated when the packages are given by a pattern, such as ./...
+//
+//options:generate option=EndpointOption public
+type Endpoint struct {
+	Host string
+	Port int `options:",443"`
+}